@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"microservice/config"
+	"microservice/database"
+	"microservice/i18n"
+	"microservice/models"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Usage describes the commands of the binary
+const Usage = `usage: microservice [flags] [command]
+
+Commands:
+  serve                                    start the server (default)
+  migrate up|down|status|create            manage schema migrations
+  seed <file.yaml>                         load attributes, groups and users from fixtures
+  user create|list|disable|set-password    manage users
+  client create                            create a client using the client credentials grant
+  token issue                              issue a token, for debugging
+  keys rotate                              replace the key signing tokens
+
+Flags such as -config or -database.url come before the command, run with -h to list them.
+Run a command with -h to list its own flags.`
+
+// output is where commands print their results
+var output io.Writer = os.Stdout
+
+// errUsage reports invalid arguments, the usage of the command being printed instead
+var errUsage = errors.New("invalid arguments")
+
+// command runs with the configuration and the arguments following its name
+type command func(cfg *config.Config, args []string) error
+
+// commands lists the commands by name
+var commands = map[string]command{
+	"serve":   serve,
+	"migrate": migrate,
+	"seed":    seed,
+	"user":    user,
+	"client":  client,
+	"token":   token,
+	"keys":    keys,
+}
+
+// Run runs the command named by the first argument, starting the server when there is none
+func Run(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return serve(cfg, nil)
+	}
+	if args[0] == "help" {
+		fmt.Fprintln(output, Usage)
+		return nil
+	}
+	run, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], Usage)
+	}
+	err := run(cfg, args[1:])
+	if err == flag.ErrHelp {
+		return nil
+	}
+	return err
+}
+
+// subcommand runs the subcommand named by the first argument among those of a command
+func subcommand(cfg *config.Config, args []string, usage string, subcommands map[string]command) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	run, ok := subcommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+	err := run(cfg, args[1:])
+	if err == errUsage {
+		return errors.New(usage)
+	}
+	return err
+}
+
+// parseArgs parses the flags placed before or after the positional arguments, and returns
+// the positional arguments
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// newFlags returns the flag set of a command, printing its usage on -h
+func newFlags(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage:", usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// connect prepares the database layer shared with the server: it loads the catalogs and
+// lists validation relies on, registers the model validations and their translations and
+// opens the database, applying pending migrations unless disabled, which it returns
+func connect(cfg *config.Config) (*gorm.DB, error) {
+	if err := cfg.Database.Validate(); err != nil {
+		return nil, err
+	}
+	if err := loadResources(cfg); err != nil {
+		return nil, err
+	}
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := i18n.RegisterValidator(v); err != nil {
+			return nil, err
+		}
+		if err := models.RegisterValidations(v); err != nil {
+			return nil, err
+		}
+	}
+	return database.ConnectDatabase(cfg.Database), nil
+}
+
+// loadResources loads the additional locale catalogs and the disposable email domain denylist
+func loadResources(cfg *config.Config) error {
+	if cfg.I18n.LocalesDir != "" {
+		if err := i18n.LoadDir(cfg.I18n.LocalesDir); err != nil {
+			return fmt.Errorf("loading locales: %w", err)
+		}
+	}
+	if cfg.Users.DisposableDomainsFile != "" {
+		if err := models.LoadDisposableDomains(cfg.Users.DisposableDomainsFile); err != nil {
+			return fmt.Errorf("loading disposable email domains: %w", err)
+		}
+	}
+	return nil
+}
+
+// validationError formats the validation errors of a record, one field per line
+func validationError(err error) error {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	lines := make([]string, 0, len(errs))
+	for _, e := range errs {
+		lines = append(lines, "  "+i18n.TranslateFieldError("en", e))
+	}
+	return errors.New("invalid record:\n" + strings.Join(lines, "\n"))
+}
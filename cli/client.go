@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"microservice/config"
+	"microservice/models"
+)
+
+// clientUsage describes the client subcommands
+const clientUsage = `usage: client <command>
+
+  create -name <name> [-scope <scopes>]
+                          create a client obtaining tokens with the client credentials grant,
+                          printing its secret once`
+
+// client manages the clients of the client credentials grant
+func client(cfg *config.Config, args []string) error {
+	return subcommand(cfg, args, clientUsage, map[string]command{
+		"create": clientCreate,
+	})
+}
+
+// clientCreate creates a client and prints its credentials
+func clientCreate(cfg *config.Config, args []string) error {
+	flags := newFlags("client create", "client create -name <name> [-scope <scopes>]")
+	name := flags.String("name", "", "Name of the client")
+	scope := flags.String("scope", "read:users", "Space-separated scopes granted to the tokens of the client")
+	if positional, err := parseArgs(flags, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return errUsage
+	}
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+
+	c, secret, err := models.NewClient(*name, *scope)
+	if err != nil {
+		return err
+	}
+	if err := models.ValidateStruct(models.WithDB(context.Background(), db), c); err != nil {
+		return validationError(err)
+	}
+	if err := db.Create(c).Error; err != nil {
+		return fmt.Errorf("creating the client: %w", err)
+	}
+
+	fmt.Fprintf(output, "Created client %s with scope %q\n", c.Name, c.Scope)
+	fmt.Fprintln(output, "Client ID:    ", c.ClientID)
+	fmt.Fprintln(output, "Client secret:", secret)
+	fmt.Fprintln(output, "The secret is not shown again.")
+	return nil
+}
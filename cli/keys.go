@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"fmt"
+	"microservice/config"
+	"microservice/models"
+	"microservice/tokens"
+)
+
+// keysUsage describes the keys subcommands
+const keysUsage = `usage: keys <command>
+
+  rotate                  create a new key signing tokens, retiring the current one, which
+                          keeps verifying the tokens it signed until they expire`
+
+// keys manages the keys signing tokens
+func keys(cfg *config.Config, args []string) error {
+	return subcommand(cfg, args, keysUsage, map[string]command{
+		"rotate": keysRotate,
+	})
+}
+
+// keysRotate replaces the key signing tokens
+func keysRotate(cfg *config.Config, args []string) error {
+	if positional, err := parseArgs(newFlags("keys rotate", "keys rotate"), args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return errUsage
+	}
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+
+	key, deleted, err := models.RotateSigningKeys(db, tokens.TTL)
+	if err != nil {
+		return fmt.Errorf("rotating the signing keys: %w", err)
+	}
+	fmt.Fprintf(output, "Tokens are now signed with key %s\n", key.ID)
+	if deleted > 0 {
+		fmt.Fprintf(output, "Deleted %d keys retired for over %s\n", deleted, tokens.TTL)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"fmt"
+	"microservice/config"
+	"microservice/database"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrateUsage describes the migrate subcommands
+const migrateUsage = `usage: migrate <command>
+
+  up [version]   apply the pending migrations, up to the version when given
+  down [steps]   revert the latest applied migration, or the given number of them
+  status         list the migrations and whether they are applied
+  create <name>  add empty up and down files for a new migration to ` + database.MigrationsDir
+
+// migrate applies, reverts, lists or creates schema migrations
+func migrate(cfg *config.Config, args []string) error {
+	return subcommand(cfg, args, migrateUsage, map[string]command{
+		"up":     migrateUp,
+		"down":   migrateDown,
+		"status": migrateStatus,
+		"create": migrateCreate,
+	})
+}
+
+// migrateUp applies the pending migrations
+func migrateUp(cfg *config.Config, args []string) error {
+	target, err := optionalNumber(args)
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db)
+
+	applied, err := database.MigrateUp(db, target)
+	for _, m := range applied {
+		fmt.Fprintln(output, "Applied", m)
+	}
+	if err == nil && len(applied) == 0 {
+		fmt.Fprintln(output, "The database is up to date")
+	}
+	return err
+}
+
+// migrateDown reverts the latest applied migrations
+func migrateDown(cfg *config.Config, args []string) error {
+	steps, err := optionalNumber(args)
+	if err != nil {
+		return err
+	}
+	if steps == 0 {
+		steps = 1
+	}
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db)
+
+	reverted, err := database.MigrateDown(db, steps)
+	for _, m := range reverted {
+		fmt.Fprintln(output, "Reverted", m)
+	}
+	if err == nil && len(reverted) == 0 {
+		fmt.Fprintln(output, "No migration is applied")
+	}
+	return err
+}
+
+// migrateStatus lists the migrations and whether they are applied
+func migrateStatus(cfg *config.Config, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db)
+
+	states, err := database.MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, state := range states {
+		appliedAt := ""
+		if state.AppliedAt != nil {
+			appliedAt = state.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", state.Version, state.Name, state.State, appliedAt)
+	}
+	return w.Flush()
+}
+
+// migrateCreate adds the files of a new migration to the source tree
+func migrateCreate(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	paths, err := database.CreateMigration(database.MigrationsDir, args[0])
+	for _, path := range paths {
+		fmt.Fprintln(output, "Created", path)
+	}
+	return err
+}
+
+// openDatabase opens the database without migrating it
+func openDatabase(cfg *config.Config) (*gorm.DB, error) {
+	if err := cfg.Database.Validate(); err != nil {
+		return nil, err
+	}
+	return database.Open(cfg.Database)
+}
+
+// closeDatabase closes the connections of a database opened by openDatabase
+func closeDatabase(db *gorm.DB) {
+	if pool, err := db.DB(); err == nil {
+		pool.Close()
+	}
+}
+
+// optionalNumber returns the positive number given as the only argument, or 0 without arguments
+func optionalNumber(args []string) (int, error) {
+	switch len(args) {
+	case 0:
+		return 0, nil
+	case 1:
+		number, err := strconv.Atoi(args[0])
+		if err != nil || number < 1 {
+			return 0, fmt.Errorf("invalid number %q\n\n%s", args[0], migrateUsage)
+		}
+		return number, nil
+	default:
+		return 0, errUsage
+	}
+}
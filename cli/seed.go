@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"microservice/config"
+	"microservice/models"
+	"microservice/repositories"
+	"microservice/services"
+	"os"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Fixtures are the records loaded by the seed command. Records that already exist, matched
+// by name or email, are left unchanged, so seeding can be repeated.
+type Fixtures struct {
+	Attributes []AttributeFixture `yaml:"attributes"`
+	Groups     []GroupFixture     `yaml:"groups"`
+	Users      []UserFixture      `yaml:"users"`
+}
+
+// AttributeFixture defines a custom user attribute
+type AttributeFixture struct {
+	Name        string `yaml:"name"`
+	Type        string `yaml:"type"`
+	Required    bool   `yaml:"required"`
+	Validation  string `yaml:"validation"`
+	ReadScope   string `yaml:"read_scope"`
+	Description string `yaml:"description"`
+}
+
+// GroupFixture defines a group, nested in the groups it is a member of
+type GroupFixture struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	MemberOf    []string `yaml:"member_of"`
+}
+
+// UserFixture defines a user, active with a password and invited without one
+type UserFixture struct {
+	Name     string                 `yaml:"name"`
+	Email    string                 `yaml:"email"`
+	Age      int                    `yaml:"age"`
+	Password string                 `yaml:"password"`
+	Metadata map[string]interface{} `yaml:"metadata"`
+	Groups   []string               `yaml:"groups"`
+}
+
+// seed loads the fixtures of a YAML file
+func seed(cfg *config.Config, args []string) error {
+	positional, err := parseArgs(newFlags("seed", "seed <file.yaml>"), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: seed <file.yaml>")
+	}
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		return err
+	}
+	var fixtures Fixtures
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fixtures); err != nil {
+		return fmt.Errorf("fixtures %s: %w", positional[0], err)
+	}
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Attributes come first, as user metadata is validated against them
+	ctx := context.Background()
+	users := services.NewUserService(repositories.NewGormUsers(db), nil, cfg.Users.InvitationTTL)
+	created := 0
+	for _, fixture := range fixtures.Attributes {
+		attribute := models.Attribute{
+			Name:        fixture.Name,
+			Type:        fixture.Type,
+			Required:    fixture.Required,
+			Validation:  fixture.Validation,
+			ReadScope:   fixture.ReadScope,
+			Description: fixture.Description,
+		}
+		ok, err := createUnlessExists(db, &attribute, "name = ?", fixture.Name, func() error {
+			return createValid(ctx, db, &attribute)
+		})
+		if err != nil {
+			return fmt.Errorf("attribute %s: %w", fixture.Name, err)
+		}
+		if ok {
+			created++
+		}
+	}
+	fmt.Fprintf(output, "Attributes: %d created, %d existing\n", created, len(fixtures.Attributes)-created)
+
+	created = 0
+	groups := map[string]uint{}
+	for _, fixture := range fixtures.Groups {
+		group := models.Group{Name: fixture.Name, Description: fixture.Description}
+		ok, err := createUnlessExists(db, &group, "name = ?", fixture.Name, func() error {
+			return createValid(ctx, db, &group)
+		})
+		if err != nil {
+			return fmt.Errorf("group %s: %w", fixture.Name, err)
+		}
+		if ok {
+			created++
+		}
+		groups[group.Name] = group.ID
+	}
+	for _, fixture := range fixtures.Groups {
+		for _, parent := range fixture.MemberOf {
+			if err := addMember(db, groups, parent, models.GroupMember, groups[fixture.Name]); err != nil {
+				return fmt.Errorf("group %s: %w", fixture.Name, err)
+			}
+		}
+	}
+	fmt.Fprintf(output, "Groups: %d created, %d existing\n", created, len(fixtures.Groups)-created)
+
+	created = 0
+	for _, fixture := range fixtures.Users {
+		u := models.User{Name: fixture.Name, Email: fixture.Email, Age: fixture.Age}
+		// Decode the metadata like request bodies, numbers becoming floats
+		if len(fixture.Metadata) > 0 {
+			encoded, err := json.Marshal(fixture.Metadata)
+			if err == nil {
+				err = json.Unmarshal(encoded, &u.Metadata)
+			}
+			if err != nil {
+				return fmt.Errorf("user %s: metadata: %w", fixture.Email, err)
+			}
+		}
+		if fixture.Password != "" {
+			if err := checkPassword(fixture.Password); err != nil {
+				return fmt.Errorf("user %s: %w", fixture.Email, err)
+			}
+		}
+
+		// Users are created through the service, which checks their metadata against the attributes
+		ok, err := createUnlessExists(db, &u, "email = ?", fixture.Email, func() error {
+			var err error
+			if fixture.Password != "" {
+				err = users.CreateWithPassword(ctx, &u, fixture.Password)
+			} else {
+				_, err = users.Invite(ctx, &u)
+			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("user %s: %w", fixture.Email, err)
+		}
+		if ok {
+			created++
+		}
+		for _, name := range fixture.Groups {
+			if err := addMember(db, groups, name, models.UserMember, u.ID); err != nil {
+				return fmt.Errorf("user %s: %w", fixture.Email, err)
+			}
+		}
+	}
+	fmt.Fprintf(output, "Users: %d created, %d existing\n", created, len(fixtures.Users)-created)
+	return nil
+}
+
+// createUnlessExists creates the record with create unless a record of db matches the condition,
+// loading the existing record instead. It reports whether the record was created.
+func createUnlessExists(db *gorm.DB, record interface{}, condition string, value interface{}, create func() error) (bool, error) {
+	err := db.Where(condition, value).First(record).Error
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	if err := create(); err != nil {
+		return false, validationError(err)
+	}
+	return true, nil
+}
+
+// createValid validates the record, checking unique fields against db, and creates it
+func createValid(ctx context.Context, db *gorm.DB, record interface{}) error {
+	if err := models.ValidateStruct(models.WithDB(ctx, db), record); err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Create(record).Error
+}
+
+// addMember adds a member to the named group, which must be defined by the fixtures or exist,
+// ignoring existing memberships
+func addMember(db *gorm.DB, groups map[string]uint, name, memberType string, memberID uint) error {
+	id, ok := groups[name]
+	if !ok {
+		var group models.Group
+		if err := db.Where("name = ?", name).First(&group).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("group %s not found", name)
+			}
+			return err
+		}
+		id = group.ID
+		groups[name] = id
+	}
+	err := models.AddGroupMember(db, id, memberType, memberID)
+	if err != nil && err != models.ErrAlreadyMember {
+		return fmt.Errorf("adding to group %s: %w", name, err)
+	}
+	return nil
+}
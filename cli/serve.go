@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"microservice/config"
+	v1 "microservice/controllers/api/v1"
+	"microservice/database"
+	"microservice/jobs"
+	"microservice/models"
+	"microservice/routes"
+	"microservice/storage"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// serve starts the server
+func serve(cfg *config.Config, args []string) error {
+	if _, err := parseArgs(newFlags("serve", "serve"), args); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	// Load the resources validation relies on and connect to the database
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Set up blob storage for avatars, leaving avatars unavailable when it is misconfigured
+	blobs, err := storage.New(cfg.Storage)
+	if err == nil {
+		err = models.UseBlobs(db, blobs)
+	}
+	if err != nil {
+		log.Println("Avatar storage disabled:", err)
+	}
+
+	// Purge users deleted for longer than the retention period, unless disabled with 0
+	background := jobs.NewBackground()
+	if cfg.Users.TrashRetention > 0 {
+		background.Go(func(ctx context.Context) {
+			jobs.PurgeTrash(ctx, db, time.Hour, cfg.Users.TrashRetention)
+		})
+	}
+	background.Go(func(ctx context.Context) {
+		jobs.PurgeIdempotencyKeys(ctx, db, time.Hour)
+	})
+
+	// Setup the router
+	health := v1.NewHealthHandler(db)
+	router := routes.SetupRouter(cfg, db, background, health)
+
+	// Run the server, with timeouts so that slow clients cannot hold connections open
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+	return run(server, db, background, health, cfg.Server)
+}
+
+// run serves until SIGINT or SIGTERM. It then drains health so that health checks fail for the
+// shutdown delay, stops accepting connections, waits for in-flight requests until the shutdown
+// timeout, stops the background work and closes the database.
+func run(server *http.Server, db *gorm.DB, background *jobs.Background, health *v1.HealthHandler, cfg config.Server) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	log.Println("Listening on", server.Addr)
+
+	select {
+	case err := <-serveErr:
+		background.Stop()
+		database.Close(db)
+		return err
+	case <-ctx.Done():
+	}
+
+	// A second signal stops the service at once
+	stop()
+
+	// Let load balancers notice the failing health checks before refusing connections
+	log.Println("Shutting down")
+	health.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+
+	// Drain in-flight requests, then close the connections of the requests that are still running
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		server.Close()
+		err = fmt.Errorf("in-flight requests did not complete within %s", cfg.ShutdownTimeout)
+	}
+
+	// Imports and purges use the database, so they are stopped before it is closed
+	background.Stop()
+	if closeErr := database.Close(db); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		log.Println("Stopped")
+	}
+	return err
+}
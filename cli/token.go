@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"microservice/config"
+	"microservice/tokens"
+	"strings"
+	"time"
+)
+
+// tokenUsage describes the token subcommands
+const tokenUsage = `usage: token <command>
+
+  issue -sub <subject> [-scope <scopes>] [-groups <names>] [-ttl <duration>]
+                          sign a token for any subject, for debugging`
+
+// token issues tokens
+func token(cfg *config.Config, args []string) error {
+	return subcommand(cfg, args, tokenUsage, map[string]command{
+		"issue": tokenIssue,
+	})
+}
+
+// tokenIssue prints a token with the given claims, signed like those of the token endpoint
+func tokenIssue(cfg *config.Config, args []string) error {
+	flags := newFlags("token issue", "token issue -sub <subject> [-scope <scopes>] [-groups <names>] [-ttl <duration>]")
+	subject := flags.String("sub", "", "Subject of the token, such as the ID of a user")
+	scope := flags.String("scope", tokens.DefaultScope, "Space-separated scopes of the token")
+	groups := flags.String("groups", "", "Comma-separated names of the groups listed in the token")
+	ttl := flags.Duration("ttl", time.Hour, "How long the token remains valid")
+	if positional, err := parseArgs(flags, args); err != nil {
+		return err
+	} else if len(positional) > 0 || *subject == "" {
+		return errUsage
+	}
+	// Retired signing keys only verify tokens for the default lifetime
+	if *ttl <= 0 || *ttl > tokens.TTL {
+		return fmt.Errorf("-ttl must be between 0 and %s, got %s", tokens.TTL, *ttl)
+	}
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+
+	claims := tokens.Claims{Subject: *subject, Scope: *scope, TTL: *ttl}
+	if *groups != "" {
+		claims.Groups = strings.Split(*groups, ",")
+	}
+	signed, err := tokens.Issue(db, cfg.Auth, claims)
+	if err != nil {
+		return fmt.Errorf("issuing the token: %w", err)
+	}
+	fmt.Fprintln(output, signed)
+	return nil
+}
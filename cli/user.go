@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"microservice/config"
+	"microservice/models"
+	"microservice/repositories"
+	"microservice/services"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// userUsage describes the user subcommands
+const userUsage = `usage: user <command>
+
+  create -name <name> -email <email> [-password <password>]
+                          create an active user, or invite them when no password is given
+  list [-status <status>] [-limit <n>]
+                          list the users, newest first
+  disable <id|email>      deactivate a user, rejecting their tokens
+  set-password <id|email> [-password <password>]
+                          set the password of a user, read from the standard input when not
+                          given, activating invited users`
+
+// Password length bounds, as enforced when accepting invitations
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// user manages users
+func user(cfg *config.Config, args []string) error {
+	return subcommand(cfg, args, userUsage, map[string]command{
+		"create":       userCreate,
+		"list":         userList,
+		"disable":      userDisable,
+		"set-password": userSetPassword,
+	})
+}
+
+// userCreate creates an active user with a password, or an invited user
+func userCreate(cfg *config.Config, args []string) error {
+	flags := newFlags("user create", "user create -name <name> -email <email> [-password <password>]")
+	name := flags.String("name", "", "Name of the user")
+	email := flags.String("email", "", "Email of the user")
+	password := flags.String("password", "", "Password of the user, who is invited when empty")
+	if positional, err := parseArgs(flags, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return errUsage
+	}
+	if *password != "" {
+		if err := checkPassword(*password); err != nil {
+			return err
+		}
+	}
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Users without a password set it by accepting their invitation
+	u := models.User{Name: *name, Email: *email}
+	users := services.NewUserService(repositories.NewGormUsers(db), nil, cfg.Users.InvitationTTL)
+	var invitation string
+	if *password == "" {
+		invitation, err = users.Invite(context.Background(), &u)
+	} else {
+		err = users.CreateWithPassword(context.Background(), &u, *password)
+	}
+	var invalid *services.ValidationError
+	if errors.As(err, &invalid) {
+		return validationError(err)
+	}
+	if err != nil {
+		return fmt.Errorf("creating the user: %w", err)
+	}
+
+	fmt.Fprintf(output, "Created user %d <%s> with status %s\n", u.ID, u.Email, u.Status)
+	if invitation != "" {
+		fmt.Fprintf(output, "Invitation token, valid until %s: %s\n", u.InvitationExpiresAt.Format(time.RFC3339), invitation)
+	}
+	return nil
+}
+
+// userList lists the users, newest first
+func userList(cfg *config.Config, args []string) error {
+	flags := newFlags("user list", "user list [-status <status>] [-limit <n>]")
+	status := flags.String("status", "", "Only list users with the status")
+	limit := flags.Int("limit", 50, "Maximum number of users listed")
+	if positional, err := parseArgs(flags, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return errUsage
+	}
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+
+	query := db.Order("id DESC").Limit(*limit)
+	if *status != "" {
+		if _, ok := models.StatusTransitions[*status]; !ok {
+			return fmt.Errorf("unknown status %q", *status)
+		}
+		query = query.Where("status = ?", *status)
+	}
+	var users []models.User
+	if err := query.Find(&users).Error; err != nil {
+		return fmt.Errorf("listing users: %w", err)
+	}
+
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tEMAIL\tSTATUS\tCREATED AT")
+	for _, u := range users {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", u.ID, u.Name, u.Email, u.Status, u.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// userDisable deactivates a user
+func userDisable(cfg *config.Config, args []string) error {
+	positional, err := parseArgs(newFlags("user disable", "user disable <id|email>"), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+
+	u, err := findUser(db, positional[0])
+	if err != nil {
+		return err
+	}
+	if err := u.Transition(models.StatusDeactivated, "", nil); err != nil {
+		return fmt.Errorf("user %d has status %s and cannot be deactivated", u.ID, u.Status)
+	}
+	if err := models.SaveVersioned(db, u); err != nil {
+		return fmt.Errorf("deactivating the user: %w", err)
+	}
+	fmt.Fprintf(output, "Deactivated user %d <%s>\n", u.ID, u.Email)
+	return nil
+}
+
+// userSetPassword sets the password of a user, activating invited users
+func userSetPassword(cfg *config.Config, args []string) error {
+	flags := newFlags("user set-password", "user set-password <id|email> [-password <password>]")
+	password := flags.String("password", "", "New password, read from the standard input when empty")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+
+	// Read the password from the standard input, so that it does not show in the shell history
+	if *password == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return errors.New("reading the password from the standard input: no password given")
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+	if err := checkPassword(*password); err != nil {
+		return err
+	}
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+
+	u, err := findUser(db, positional[0])
+	if err != nil {
+		return err
+	}
+	if err := u.SetPassword(*password); err != nil {
+		return err
+	}
+	if u.Status == models.StatusInvited {
+		u.Transition(models.StatusActive, "", nil)
+	}
+	if err := models.SaveVersioned(db, u); err != nil {
+		return fmt.Errorf("setting the password: %w", err)
+	}
+	fmt.Fprintf(output, "Set the password of user %d <%s>, whose status is %s\n", u.ID, u.Email, u.Status)
+	return nil
+}
+
+// findUser returns the user of db with the ID or email
+func findUser(db *gorm.DB, idOrEmail string) (*models.User, error) {
+	var u models.User
+	query := db.Where("email = ?", idOrEmail)
+	if id, err := strconv.ParseUint(idOrEmail, 10, 0); err == nil {
+		query = db.Where("id = ?", id)
+	}
+	if err := query.First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("user %s not found", idOrEmail)
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// checkPassword checks the length of a password
+func checkPassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return fmt.Errorf("the password must be between %d and %d bytes long", minPasswordLength, maxPasswordLength)
+	}
+	return nil
+}
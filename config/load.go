@@ -0,0 +1,184 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// setting is a configurable field of Config
+type setting struct {
+	key   string // Dotted path of the setting, such as server.port
+	env   string // Environment variable of the setting
+	help  string // Description shown by -help
+	value reflect.Value
+}
+
+// Load reads the configuration from the defaults, the configuration file named by the -config
+// flag or CONFIG_FILE, the environment, including an optional .env file, and the command-line
+// flags. It returns the arguments following the flags, such as a subcommand. Callers validate
+// the settings they use.
+func Load(args []string) (*Config, []string, error) {
+	// Variables set in the environment take precedence over the .env file, which is optional
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("loading .env: %w", err)
+	}
+
+	cfg := Default()
+	settings := cfg.settings()
+
+	// Parse the flags first to find the configuration file, and apply them last
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	file := flags.String("config", os.Getenv("CONFIG_FILE"), "Configuration file, YAML (.yaml, .yml) or TOML (.toml) (CONFIG_FILE)")
+	overrides := map[string]string{}
+	for _, s := range settings {
+		key := s.key
+		record := func(value string) error {
+			overrides[key] = value
+			return nil
+		}
+		usage := fmt.Sprintf("%s (%s)", s.help, s.env)
+		if s.value.Kind() == reflect.Bool {
+			flags.BoolFunc(key, usage, record)
+		} else {
+			flags.Func(key, usage, record)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *file != "" {
+		if err := cfg.loadFile(*file); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok && value != "" {
+			if err := s.set(value); err != nil {
+				return nil, nil, fmt.Errorf("environment variable %s: %w", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if value, ok := overrides[s.key]; ok {
+			if err := s.set(value); err != nil {
+				return nil, nil, fmt.Errorf("flag -%s: %w", s.key, err)
+			}
+		}
+	}
+
+	return cfg, flags.Args(), nil
+}
+
+// loadFile applies the settings of a YAML or TOML file, rejecting unknown settings
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading configuration file: %w", err)
+	}
+	tree := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return fmt.Errorf("configuration file %s: unsupported format %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("configuration file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	flatten("", tree, values)
+	settings := map[string]setting{}
+	for _, s := range c.settings() {
+		settings[s.key] = s
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s, ok := settings[key]
+		if !ok {
+			return fmt.Errorf("configuration file %s: unknown setting %q", path, key)
+		}
+		if err := s.set(values[key]); err != nil {
+			return fmt.Errorf("configuration file %s: %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// settings returns the configurable fields of the configuration
+func (c *Config) settings() []setting {
+	return collect("", reflect.ValueOf(c).Elem(), nil)
+}
+
+// collect appends the fields of a configuration section, descending into nested sections
+func collect(prefix string, section reflect.Value, settings []setting) []setting {
+	for i := 0; i < section.NumField(); i++ {
+		field := section.Type().Field(i)
+		key := prefix + field.Tag.Get("key")
+		if field.Type.Kind() == reflect.Struct {
+			settings = collect(key+".", section.Field(i), settings)
+			continue
+		}
+		settings = append(settings, setting{key: key, env: field.Tag.Get("env"), help: field.Tag.Get("help"), value: section.Field(i)})
+	}
+	return settings
+}
+
+// flatten turns nested file sections into dotted keys and their values as text
+func flatten(prefix string, tree map[string]interface{}, values map[string]string) {
+	for key, value := range tree {
+		if section, ok := value.(map[string]interface{}); ok {
+			flatten(prefix+key+".", section, values)
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		values[prefix+key] = fmt.Sprint(value)
+	}
+}
+
+// set parses the text value of the setting
+func (s setting) set(text string) error {
+	switch {
+	case s.value.Type() == reflect.TypeOf(time.Duration(0)):
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, use a value such as 90s, 15m or 24h", text)
+		}
+		s.value.SetInt(int64(duration))
+	case s.value.Kind() == reflect.Int:
+		number, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", text)
+		}
+		s.value.SetInt(int64(number))
+	case s.value.Kind() == reflect.Bool:
+		flag, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q, use true or false", text)
+		}
+		s.value.SetBool(flag)
+	default:
+		s.value.SetString(text)
+	}
+	return nil
+}
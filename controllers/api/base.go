@@ -4,19 +4,18 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"microservice/i18n"
 	"net/http"
 	"sort"
-	"strconv"
 	"sync"
 
 	"github.com/gin-gonic/gin"
 )
 
-// PaginationResponse represents pagination metadata
-type PaginationResponse struct {
-	Next     string `json:"next"`
-	Previous string `json:"previous"`
-	Total    int    `json:"total"`
+// ListResponse represents a page of resources with its pagination metadata
+type ListResponse struct {
+	Data       interface{}        `json:"data"`
+	Pagination PaginationResponse `json:"pagination"`
 }
 
 type DataPaginationResponse struct {
@@ -24,20 +23,33 @@ type DataPaginationResponse struct {
 	Pagination PaginationResponse       `json:"pagination"`
 }
 
-// RespondWithError responds with a JSON error message
-func RespondWithError(c *gin.Context, code int, message string, errors ...map[string][]string) {
-	// Prepare the response map
-	response := gin.H{"message": message}
-	if len(errors) > 0 {
-		errorMap := make(map[string][]string)
-		for _, errMap := range errors {
-			for field, msgs := range errMap {
-				errorMap[field] = append(errorMap[field], msgs...)
-			}
+// ErrorResponse is the body of error responses
+type ErrorResponse struct {
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Errors  map[string][]string `json:"errors,omitempty"`
+}
+
+// NewErrorResponse builds an error response translated into the request locale.
+// The message is an error code looked up in the i18n catalogs.
+func NewErrorResponse(c *gin.Context, message string, errors ...map[string][]string) *ErrorResponse {
+	response := &ErrorResponse{Code: message, Message: i18n.T(i18n.FromContext(c), message)}
+	errorMap := make(map[string][]string)
+	for _, errMap := range errors {
+		for field, msgs := range errMap {
+			errorMap[field] = append(errorMap[field], msgs...)
 		}
-		response["errors"] = errorMap
 	}
-	c.JSON(code, response)
+	if len(errorMap) > 0 {
+		response.Errors = errorMap
+	}
+	return response
+}
+
+// RespondWithError responds with a JSON error message translated into the request locale.
+// The message is an error code looked up in the i18n catalogs.
+func RespondWithError(c *gin.Context, code int, message string, errors ...map[string][]string) {
+	c.JSON(code, NewErrorResponse(c, message, errors...))
 }
 
 // RespondWithJSON responds with a JSON payload
@@ -45,25 +57,6 @@ func RespondWithJSON(c *gin.Context, code int, payload interface{}) {
 	c.JSON(code, payload)
 }
 
-// ValidateAndParsePagination validates pagination parameters and returns page and limit
-func ValidateAndParsePagination(c *gin.Context) (page, limit int) {
-	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ = strconv.Atoi(c.DefaultQuery("limit", "10"))
-	return page, limit
-}
-
-// GetPaginationLinks generates pagination links based on current page and limit
-func GetPaginationLinks(c *gin.Context, page, limit, totalCount int) (nextPage, prevPage string) {
-	basePath := c.Request.URL.Path
-	if page*limit < totalCount {
-		nextPage = fmt.Sprintf("%s?page=%d&limit=%d", basePath, page+1, limit)
-	}
-	if page > 1 {
-		prevPage = fmt.Sprintf("%s?page=%d&limit=%d", basePath, page-1, limit)
-	}
-	return nextPage, prevPage
-}
-
 // RequestOptions represents the request options for each concurrent request
 type RequestOptions struct {
 	Index       int                    // Index of the request
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"microservice/i18n"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBatchSize is the maximum number of operations in a batch request
+const MaxBatchSize = 1000
+
+// Methods of batch operations
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// BatchRequest is a list of operations applied in order
+type BatchRequest struct {
+	Atomic     bool             `json:"atomic"`     // Apply all operations or none of them
+	Operations []BatchOperation `json:"operations"` // Operations in the order they are applied
+}
+
+// BatchOperation is a single create, update or delete of a batch
+type BatchOperation struct {
+	Method string          `json:"method" enums:"create,update,delete"`
+	ID     uint            `json:"id,omitempty"`                        // Record to update or delete
+	ETag   string          `json:"etag,omitempty"`                      // Expected ETag of the record, as with If-Match
+	Data   json.RawMessage `json:"data,omitempty" swaggertype:"object"` // Record to create, or merge patch to update with
+}
+
+// BatchResult is the outcome of a batch operation, at the same index as in the request
+type BatchResult struct {
+	Index  int            `json:"index"`
+	Status int            `json:"status"`
+	Data   interface{}    `json:"data,omitempty"`
+	Error  *ErrorResponse `json:"error,omitempty"`
+}
+
+// BatchResponse lists the outcome of each operation of a batch
+type BatchResponse struct {
+	Atomic  bool          `json:"atomic"`
+	Results []BatchResult `json:"results"`
+}
+
+// Succeeded reports whether the operation was applied
+func (r *BatchResult) Succeeded() bool {
+	return r.Status >= 200 && r.Status < 300
+}
+
+// ParseBatchRequest decodes a batch request, responding with 400 Bad Request and
+// returning nil when it is malformed, empty or larger than MaxBatchSize
+func ParseBatchRequest(c *gin.Context) *BatchRequest {
+	var request BatchRequest
+	if c.Request.Body == nil {
+		RespondWithError(c, http.StatusBadRequest, "request.invalid_json")
+		return nil
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		RespondWithError(c, http.StatusBadRequest, "request.invalid_json", map[string][]string{"_json": {err.Error()}})
+		return nil
+	}
+	if len(request.Operations) == 0 {
+		RespondWithError(c, http.StatusBadRequest, "batch.empty")
+		return nil
+	}
+	if len(request.Operations) > MaxBatchSize {
+		message := i18n.T(i18n.FromContext(c), "batch.max_operations", strconv.Itoa(MaxBatchSize))
+		RespondWithError(c, http.StatusBadRequest, "batch.too_large", map[string][]string{"operations": {message}})
+		return nil
+	}
+	return &request
+}
+
+// RespondWithBatch responds with the batch results. Operations skipped or rolled back
+// because an atomic batch failed are reported with 424 Failed Dependency, and the
+// response takes the status of the failed operation. Otherwise the response is
+// 200 OK when every operation succeeded and 207 Multi-Status when some failed.
+func RespondWithBatch(c *gin.Context, request *BatchRequest, results []BatchResult) {
+	code := http.StatusOK
+	for i := range results {
+		if !results[i].Succeeded() {
+			code = http.StatusMultiStatus
+			if request.Atomic {
+				code = results[i].Status
+			}
+			break
+		}
+	}
+
+	if request.Atomic && code != http.StatusOK {
+		for i := range results {
+			if results[i].Status == 0 || results[i].Succeeded() {
+				results[i] = BatchResult{Index: i, Status: http.StatusFailedDependency, Error: NewErrorResponse(c, "batch.aborted")}
+			}
+		}
+	}
+	RespondWithJSON(c, code, BatchResponse{Atomic: request.Atomic, Results: results})
+}
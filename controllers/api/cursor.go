@@ -0,0 +1,194 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed, tampered with or
+// issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the payload of an opaque pagination cursor
+type cursor struct {
+	Sort     string   `json:"s"`           // Sort keys the cursor was issued for
+	Values   []string `json:"v,omitempty"` // Sort key values of the boundary row
+	Backward bool     `json:"b,omitempty"` // Whether the page precedes the boundary row
+}
+
+// FindCursorPage loads into dest (a pointer to a slice of models) the page of at most limit
+// records following or preceding the row encoded in token, using keyset pagination on the
+// sort keys. An empty token loads the first page, a backward cursor without row the last one.
+// It returns the cursors of the adjacent pages, which are empty when there is no such page.
+func (q *ListQuery) FindCursorPage(db *gorm.DB, token string, limit int, dest interface{}) (next, prev string, err error) {
+	keys := q.keys()
+	sortSpec := sortSpecOf(keys)
+
+	// Restrict the query to the rows after (or before) the boundary row
+	var current *cursor
+	if token != "" {
+		if current, err = decodeCursor(token, q.secret); err != nil || current.Sort != sortSpec {
+			return "", "", ErrInvalidCursor
+		}
+		if len(current.Values) > 0 || !current.Backward {
+			if len(current.Values) != len(keys) {
+				return "", "", ErrInvalidCursor
+			}
+			condition, args, err := keysetCondition(keys, current.Values, current.Backward)
+			if err != nil {
+				return "", "", ErrInvalidCursor
+			}
+			db = db.Where(condition, args...)
+		}
+	}
+	backward := current != nil && current.Backward
+	fromRow := current != nil && len(current.Values) > 0
+
+	// Fetch one extra row to know whether another page exists
+	if err := q.order(db, backward).Limit(limit + 1).Find(dest).Error; err != nil {
+		return "", "", err
+	}
+	rows := reflect.ValueOf(dest).Elem()
+	hasMore := rows.Len() > limit
+	if hasMore {
+		rows.Set(rows.Slice(0, limit))
+	}
+	if backward {
+		// Rows were fetched in reverse order
+		swap := reflect.Swapper(rows.Interface())
+		for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+	if rows.Len() == 0 {
+		return "", "", nil
+	}
+
+	// Build the cursors from the first and last rows of the page
+	first := rows.Index(0).Addr().Interface()
+	last := rows.Index(rows.Len() - 1).Addr().Interface()
+	if (hasMore && !backward) || (backward && fromRow) {
+		next = encodeCursor(cursor{Sort: sortSpec, Values: keyValues(db, keys, last)}, q.secret)
+	}
+	if (hasMore && backward) || (fromRow && !backward) {
+		prev = encodeCursor(cursor{Sort: sortSpec, Values: keyValues(db, keys, first), Backward: true}, q.secret)
+	}
+	return next, prev, nil
+}
+
+// LastCursor returns the cursor of the last page
+func (q *ListQuery) LastCursor() string {
+	return encodeCursor(cursor{Sort: sortSpecOf(q.keys()), Backward: true}, q.secret)
+}
+
+// keysetCondition builds the condition selecting rows after the given key values in sort
+// order, or before them when backward is set:
+// (a > ?) OR (a = ? AND b > ?) OR (a = ? AND b = ? AND id > ?)
+func keysetCondition(keys []SortField, raw []string, backward bool) (string, []interface{}, error) {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		value, err := parseFilterValue(key.Kind, raw[i])
+		if err != nil {
+			return "", nil, err
+		}
+		values[i] = value
+	}
+
+	var clauses []string
+	var args []interface{}
+	for i, key := range keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, keys[j].Column+" = ?")
+			args = append(args, values[j])
+		}
+		operator := ">"
+		if key.Desc != backward {
+			operator = "<"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s ?", key.Column, operator))
+		args = append(args, values[i])
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+	return strings.Join(clauses, " OR "), args, nil
+}
+
+// keyValues returns the sort key values of a record as strings
+func keyValues(db *gorm.DB, keys []SortField, record interface{}) []string {
+	values := make([]string, len(keys))
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(record); err != nil {
+		return values
+	}
+	for i, key := range keys {
+		field := stmt.Schema.LookUpField(key.Column)
+		if field == nil {
+			continue
+		}
+		value, _ := field.ValueOf(db.Statement.Context, reflect.ValueOf(record))
+		switch value := value.(type) {
+		case time.Time:
+			values[i] = value.Format(time.RFC3339Nano)
+		default:
+			values[i] = fmt.Sprint(value)
+		}
+	}
+	return values
+}
+
+// sortSpecOf returns the sort keys in the format of the sort parameter
+func sortSpecOf(keys []SortField) string {
+	spec := make([]string, len(keys))
+	for i, key := range keys {
+		spec[i] = key.Column
+		if key.Desc {
+			spec[i] = "-" + key.Column
+		}
+	}
+	return strings.Join(spec, ",")
+}
+
+// encodeCursor serializes and signs a cursor
+func encodeCursor(cur cursor, secret []byte) string {
+	payload, _ := json.Marshal(cur)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// decodeCursor verifies the signature of a cursor and deserializes it
+func decodeCursor(token string, secret []byte) (*cursor, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var cur cursor
+	if err := json.Unmarshal(payload, &cur); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cur, nil
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"microservice/config"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETagOf returns a strong entity tag computed from the JSON representation of payload
+func ETagOf(payload interface{}) string {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(`"%x"`, sha256.Sum256(data))
+}
+
+// RespondWithETag responds with a JSON payload and its ETag header,
+// or with 304 Not Modified when the If-None-Match header matches the ETag
+func RespondWithETag(c *gin.Context, code int, etag string, payload interface{}) {
+	if NotModified(c, etag) {
+		return
+	}
+	c.JSON(code, payload)
+}
+
+// NotModified sets the ETag header and responds with 304 Not Modified when the
+// If-None-Match header matches it, reporting whether the response was sent
+func NotModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag, false) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// CheckIfMatch validates the If-Match header against the current ETag of a resource.
+// It responds with 412 Precondition Failed on mismatch, or with 428 Precondition Required
+// when the header is missing and api.require_if_match is enabled, and reports whether to proceed.
+func CheckIfMatch(c *gin.Context, etag string) bool {
+	required := config.FromContext(c).API.RequireIfMatch
+	if code, message := Precondition(c.GetHeader("If-Match"), etag, required); code != 0 {
+		RespondWithError(c, code, message)
+		return false
+	}
+	return true
+}
+
+// Precondition evaluates an If-Match value against the current ETag of a resource, the
+// value being required when required is set. It returns the status code and error code of
+// the failed precondition, or 0 when it holds.
+func Precondition(ifMatch, etag string, required bool) (int, string) {
+	if ifMatch == "" {
+		if required {
+			return http.StatusPreconditionRequired, "request.precondition_required"
+		}
+		return 0, ""
+	}
+	if !etagMatches(ifMatch, etag, true) {
+		return http.StatusPreconditionFailed, "request.precondition_failed"
+	}
+	return 0, ""
+}
+
+// etagMatches reports whether etag is listed in a conditional header value.
+// If-Match requires strong comparison, If-None-Match uses weak comparison.
+func etagMatches(header, etag string, strong bool) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if strong {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"microservice/i18n"
+	"microservice/models"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Projectable is implemented by models supporting sparse fieldsets and expansions
+type Projectable interface {
+	models.Queryable
+	models.Expandable
+}
+
+// Projection holds the sparse fieldset and expansions requested with ?fields= and ?expand=
+type Projection struct {
+	Fields  []string // Requested JSON fields, empty for all fields
+	Columns []string // Columns to select for the requested fields
+	Expand  []string // Requested expansions
+	preload []string // Associations to preload for the expansions
+}
+
+// ParseProjection parses the comma-separated fields and expand parameters against the
+// fields and expansions declared by the model. Unknown names are returned as field errors.
+func ParseProjection(c *gin.Context, model Projectable) (*Projection, map[string][]string) {
+	fields := model.QueryFields()
+	expansions := model.Expansions()
+	locale := i18n.FromContext(c)
+	projection := &Projection{}
+	errors := make(map[string][]string)
+
+	if raw := c.Query("fields"); raw != "" {
+		// The primary key and version are always loaded to identify records and compute ETags
+		projection.Columns = []string{"id", "version"}
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			field, ok := fields[name]
+			if !ok || !field.Selectable {
+				errors["fields"] = append(errors["fields"], i18n.T(locale, "query.unselectable_field", name))
+				continue
+			}
+			projection.Fields = append(projection.Fields, name)
+			projection.Columns = appendUnique(projection.Columns, field.Column)
+		}
+	}
+
+	if raw := c.Query("expand"); raw != "" {
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			association, ok := expansions[name]
+			if !ok {
+				errors["expand"] = append(errors["expand"], i18n.T(locale, "query.unknown_expansion", name))
+				continue
+			}
+			projection.Expand = append(projection.Expand, name)
+			projection.preload = append(projection.preload, association)
+		}
+	}
+
+	if len(errors) > 0 {
+		return nil, errors
+	}
+	return projection, nil
+}
+
+// IsEmpty reports whether the full representation was requested
+func (p *Projection) IsEmpty() bool {
+	return len(p.Fields) == 0 && len(p.Expand) == 0
+}
+
+// Apply restricts the selected columns and preloads the expansions. Extra columns,
+// such as the sort keys needed for cursors, are selected without being rendered.
+func (p *Projection) Apply(db *gorm.DB, extra ...string) *gorm.DB {
+	if len(p.Columns) > 0 {
+		columns := p.Columns
+		for _, column := range extra {
+			columns = appendUnique(columns, column)
+		}
+		db = db.Select(columns)
+	}
+	for _, association := range p.preload {
+		db = db.Preload(association)
+	}
+	return db
+}
+
+// Render returns the JSON representation of record restricted to the requested fields and expansions
+func (p *Projection) Render(record interface{}) interface{} {
+	if len(p.Fields) == 0 {
+		return record
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return record
+	}
+	var full map[string]json.RawMessage
+	if err := json.Unmarshal(data, &full); err != nil {
+		return record
+	}
+
+	rendered := make(map[string]interface{}, len(p.Fields)+len(p.Expand))
+	for _, name := range append(append([]string{}, p.Fields...), p.Expand...) {
+		if value, ok := full[name]; ok {
+			rendered[name] = value
+		}
+	}
+	return rendered
+}
+
+// RenderAll renders each record of a slice
+func (p *Projection) RenderAll(records interface{}) []interface{} {
+	value := reflect.ValueOf(records)
+	rendered := make([]interface{}, value.Len())
+	for i := range rendered {
+		rendered[i] = p.Render(value.Index(i).Interface())
+	}
+	return rendered
+}
+
+// appendUnique appends value unless it is already in list
+func appendUnique(list []string, value string) []string {
+	for _, item := range list {
+		if item == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
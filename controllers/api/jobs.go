@@ -0,0 +1,132 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Statuses of import jobs
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// JobRetention is how long finished jobs can still be retrieved
+const JobRetention = 24 * time.Hour
+
+// ImportRowError lists the errors of a rejected row
+type ImportRowError struct {
+	Line   int                 `json:"line"`
+	Errors map[string][]string `json:"errors"`
+}
+
+// ImportJob tracks an asynchronous import
+type ImportJob struct {
+	ID         string           `json:"id"`
+	Status     string           `json:"status" enums:"pending,running,completed,failed"`
+	Format     string           `json:"format"`
+	DryRun     bool             `json:"dry_run"`
+	Total      int              `json:"total"`   // Rows read from the file
+	Created    int              `json:"created"` // Rows creating a record, or that would in a dry run
+	Updated    int              `json:"updated"` // Rows updating a record, or that would in a dry run
+	Failed     int              `json:"failed"`  // Rows rejected
+	Errors     []ImportRowError `json:"errors"`
+	CreatedAt  time.Time        `json:"created_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+	owner      string           // Subject of the client that started the job
+	mu         sync.Mutex
+}
+
+// ImportJobs holds import jobs in memory, so they only live in the instance that runs them
+type ImportJobs struct {
+	mu   sync.Mutex
+	byID map[string]*ImportJob
+}
+
+// NewImportJobs returns an empty store of import jobs
+func NewImportJobs() *ImportJobs {
+	return &ImportJobs{byID: make(map[string]*ImportJob)}
+}
+
+// New registers a pending import job started by the client with the subject, discarding
+// jobs finished for longer than JobRetention
+func (s *ImportJobs) New(format string, dryRun bool, owner string) *ImportJob {
+	id := make([]byte, 16)
+	rand.Read(id)
+	job := &ImportJob{ID: hex.EncodeToString(id), Status: JobPending, Format: format, DryRun: dryRun, Errors: []ImportRowError{}, CreatedAt: time.Now(), owner: owner}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, other := range s.byID {
+		if snapshot := other.Snapshot(); snapshot.FinishedAt != nil && time.Since(*snapshot.FinishedAt) > JobRetention {
+			delete(s.byID, id)
+		}
+	}
+	s.byID[job.ID] = job
+	return job
+}
+
+// Find returns the import job with the given ID started by the client with the subject,
+// or nil, so that clients cannot see the imports of other clients
+func (s *ImportJobs) Find(id, owner string) *ImportJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.byID[id]; ok && job.owner == owner {
+		return job
+	}
+	return nil
+}
+
+// Start marks the job as running with the number of rows to import
+func (j *ImportJob) Start(total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Status = JobRunning
+	j.Total = total
+}
+
+// Record counts a created or updated row
+func (j *ImportJob) Record(created bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if created {
+		j.Created++
+	} else {
+		j.Updated++
+	}
+}
+
+// Reject records the errors of a row
+func (j *ImportJob) Reject(line int, errors map[string][]string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Failed++
+	j.Errors = append(j.Errors, ImportRowError{Line: line, Errors: errors})
+}
+
+// Finish marks the job as completed, or as failed when it could not process every row
+func (j *ImportJob) Finish(failed bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.Status = JobCompleted
+	if failed {
+		j.Status = JobFailed
+	}
+	j.FinishedAt = &now
+}
+
+// Snapshot returns a copy of the job safe to serialize while it runs
+func (j *ImportJob) Snapshot() *ImportJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return &ImportJob{
+		ID: j.ID, Status: j.Status, Format: j.Format, DryRun: j.DryRun,
+		Total: j.Total, Created: j.Created, Updated: j.Updated, Failed: j.Failed,
+		Errors: append([]ImportRowError{}, j.Errors...), CreatedAt: j.CreatedAt, FinishedAt: j.FinishedAt,
+	}
+}
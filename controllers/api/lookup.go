@@ -0,0 +1,51 @@
+package api
+
+import (
+	"microservice/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LookupStatus returns the status code and error code of a failed lookup of a resource,
+// such as "user" for the "user.not_found" and "user.gone" messages
+func LookupStatus(err error, resource string) (int, string) {
+	switch err {
+	case models.ErrNotFound:
+		return http.StatusNotFound, resource + ".not_found"
+	case models.ErrGone:
+		return http.StatusGone, resource + ".gone"
+	default:
+		return http.StatusInternalServerError, resource + ".fetch_failed"
+	}
+}
+
+// ParseID parses the id path parameter, responding with 400 Bad Request when it is invalid,
+// and reports whether it is valid
+func ParseID(c *gin.Context, resource string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil || id == 0 {
+		RespondWithError(c, http.StatusBadRequest, resource+".invalid_id")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// Lookup loads into dest the record identified by the id path parameter. It responds with
+// 400 Bad Request for invalid IDs, 404 Not Found for unknown records and 410 Gone for
+// soft-deleted records unless withTrashed is set, and reports whether the record was found.
+// The query is canceled when the client goes away.
+func Lookup(c *gin.Context, db *gorm.DB, dest interface{}, resource string, withTrashed bool) bool {
+	id, ok := ParseID(c, resource)
+	if !ok {
+		return false
+	}
+	if err := models.FindByID(db.WithContext(c.Request.Context()), dest, id, withTrashed); err != nil {
+		code, message := LookupStatus(err, resource)
+		RespondWithError(c, code, message)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"fmt"
+	"microservice/config"
+	"microservice/i18n"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultPageSize is the number of items per page when no limit is requested. The maximum
+// is configured with api.max_page_size.
+const DefaultPageSize = 10
+
+// MaxPage is the last page offset pagination reaches, so that offsets stay cheap and cannot
+// overflow. Deeper pages are reached with cursor pagination.
+const MaxPage = 10000
+
+// PaginationResponse represents pagination metadata
+type PaginationResponse struct {
+	Next     string `json:"next"`
+	Previous string `json:"previous"`
+	First    string `json:"first"`
+	Last     string `json:"last"`
+	Page     int    `json:"page,omitempty"`
+	Limit    int    `json:"limit"`
+	Pages    *int   `json:"pages,omitempty"`
+	Total    *int   `json:"total,omitempty"`
+}
+
+// ValidateAndParsePagination validates pagination parameters and returns page and limit.
+// Field errors are returned for pages outside 1 to MaxPage and limits above the maximum page size.
+func ValidateAndParsePagination(c *gin.Context) (page, limit int, errors map[string][]string) {
+	locale := i18n.FromContext(c)
+	errors = make(map[string][]string)
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 || page > MaxPage {
+		errors["page"] = append(errors["page"], i18n.T(locale, "pagination.invalid_page", strconv.Itoa(MaxPage)))
+	}
+
+	maxLimit := config.FromContext(c).API.MaxPageSize
+	limit, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultPageSize)))
+	if err != nil || limit < 1 || limit > maxLimit {
+		errors["limit"] = append(errors["limit"], i18n.T(locale, "pagination.invalid_limit", strconv.Itoa(maxLimit)))
+	}
+
+	if len(errors) > 0 {
+		return 0, 0, errors
+	}
+	return page, limit, nil
+}
+
+// GetPagination generates offset pagination metadata and links based on current page and limit.
+// When the total is unknown, hasNext tells whether a next page exists and no last link is set.
+func GetPagination(c *gin.Context, page, limit int, total *int, hasNext bool) PaginationResponse {
+	pagination := PaginationResponse{
+		First: pageLink(c, map[string]string{"page": "1", "limit": strconv.Itoa(limit)}),
+		Page:  page,
+		Limit: limit,
+		Total: total,
+	}
+	if total != nil {
+		pages := (*total + limit - 1) / limit
+		pagination.Pages = &pages
+		pagination.Last = pageLink(c, map[string]string{"page": strconv.Itoa(max(pages, 1)), "limit": strconv.Itoa(limit)})
+		hasNext = page < pages
+	}
+	if hasNext {
+		pagination.Next = pageLink(c, map[string]string{"page": strconv.Itoa(page + 1), "limit": strconv.Itoa(limit)})
+	}
+	if page > 1 {
+		pagination.Previous = pageLink(c, map[string]string{"page": strconv.Itoa(page - 1), "limit": strconv.Itoa(limit)})
+	}
+	return pagination
+}
+
+// GetCursorPagination generates cursor pagination metadata from the cursors of the adjacent and last pages
+func GetCursorPagination(c *gin.Context, limit int, next, prev, last string, total *int) PaginationResponse {
+	pagination := PaginationResponse{
+		First: pageLink(c, map[string]string{"pagination": "cursor", "cursor": ""}),
+		Limit: limit,
+		Total: total,
+	}
+	if next != "" {
+		pagination.Next = pageLink(c, map[string]string{"pagination": "", "cursor": next})
+	}
+	if prev != "" {
+		pagination.Previous = pageLink(c, map[string]string{"pagination": "", "cursor": prev})
+	}
+	if last != "" {
+		pagination.Last = pageLink(c, map[string]string{"pagination": "", "cursor": last})
+	}
+	return pagination
+}
+
+// SetPaginationHeaders sets the RFC 8288 Link header and the X-Total-Count header
+func SetPaginationHeaders(c *gin.Context, pagination PaginationResponse) {
+	var links []string
+	for _, link := range []struct{ rel, url string }{
+		{"first", pagination.First},
+		{"prev", pagination.Previous},
+		{"next", pagination.Next},
+		{"last", pagination.Last},
+	} {
+		if link.url != "" {
+			links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, link.url, link.rel))
+		}
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+	if pagination.Total != nil {
+		c.Header("X-Total-Count", strconv.Itoa(*pagination.Total))
+	}
+}
+
+// IsCursorPagination reports whether the client requested cursor pagination,
+// either with a cursor or with pagination=cursor for the first page
+func IsCursorPagination(c *gin.Context) bool {
+	return c.Query("cursor") != "" || c.Query("pagination") == "cursor"
+}
+
+// WantsTotalCount reports whether the total count should be computed; count=false skips it
+func WantsTotalCount(c *gin.Context) bool {
+	count, err := strconv.ParseBool(c.DefaultQuery("count", "true"))
+	return err != nil || count
+}
+
+// pageLink generates a link to the current path, preserving the original query parameters
+// and applying the given overrides. Empty overrides remove the parameter.
+func pageLink(c *gin.Context, overrides map[string]string) string {
+	query := c.Request.URL.Query()
+	for key, value := range overrides {
+		if value == "" {
+			query.Del(key)
+		} else {
+			query.Set(key, value)
+		}
+	}
+	return c.Request.URL.Path + "?" + query.Encode()
+}
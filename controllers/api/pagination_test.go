@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateAndParsePagination(t *testing.T) {
+	tests := []struct {
+		query string
+		valid bool
+	}{
+		{"", true},
+		{"page=2&limit=20", true},
+		{"page=10000", true},
+		{"page=0", false},
+		{"page=10001", false},
+		{"page=9223372036854775807", false},
+		{"limit=0", false},
+	}
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/users?"+test.query, nil)
+		_, _, errors := ValidateAndParsePagination(c)
+		if valid := len(errors) == 0; valid != test.valid {
+			t.Errorf("ValidateAndParsePagination(%q) errors = %v, want valid %v", test.query, errors, test.valid)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"microservice/i18n"
+	"net/http"
+	"reflect"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+)
+
+// Content types accepted by PATCH endpoints
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// AcceptPatch lists the supported patch formats for the Accept-Patch header
+var AcceptPatch = strings.Join([]string{MergePatchContentType, JSONPatchContentType}, ", ")
+
+// PatchError describes why a patch could not be applied
+type PatchError struct {
+	Code    int                 // HTTP status code
+	Message string              // Error code for the response message
+	Errors  map[string][]string // Field errors, if any
+}
+
+func (e *PatchError) Error() string {
+	return e.Message
+}
+
+// ApplyPatch applies the request body to target as a JSON Merge Patch (RFC 7396) or a
+// JSON Patch (RFC 6902), depending on the request content type. Plain application/json
+// bodies are treated as merge patches. Patches changing any of the readOnly fields are rejected.
+func ApplyPatch(c *gin.Context, target interface{}, readOnly []string) *PatchError {
+	original, err := json.Marshal(target)
+	if err != nil {
+		return &PatchError{Code: http.StatusInternalServerError, Message: "request.invalid_patch"}
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return &PatchError{Code: http.StatusBadRequest, Message: "request.invalid_patch"}
+	}
+
+	// Apply the patch according to its format
+	var patched []byte
+	switch c.ContentType() {
+	case MergePatchContentType, gin.MIMEJSON:
+		patched, err = jsonpatch.MergePatch(original, body)
+	case JSONPatchContentType:
+		var patch jsonpatch.Patch
+		if patch, err = jsonpatch.DecodePatch(body); err == nil {
+			patched, err = patch.Apply(original)
+		}
+	default:
+		c.Header("Accept-Patch", AcceptPatch)
+		return &PatchError{Code: http.StatusUnsupportedMediaType, Message: "request.unsupported_media_type"}
+	}
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return &PatchError{Code: http.StatusConflict, Message: "request.patch_test_failed"}
+	}
+	if err != nil {
+		return &PatchError{Code: http.StatusBadRequest, Message: "request.invalid_patch", Errors: map[string][]string{"_patch": {err.Error()}}}
+	}
+
+	return applyPatched(c, target, original, patched, readOnly)
+}
+
+// ApplyMergePatch applies a JSON Merge Patch (RFC 7396) document to target,
+// rejecting changes to any of the readOnly fields
+func ApplyMergePatch(c *gin.Context, target interface{}, patch []byte, readOnly []string) *PatchError {
+	original, err := json.Marshal(target)
+	if err != nil {
+		return &PatchError{Code: http.StatusInternalServerError, Message: "request.invalid_patch"}
+	}
+	patched, err := jsonpatch.MergePatch(original, patch)
+	if err != nil {
+		return &PatchError{Code: http.StatusBadRequest, Message: "request.invalid_patch", Errors: map[string][]string{"_patch": {err.Error()}}}
+	}
+	return applyPatched(c, target, original, patched, readOnly)
+}
+
+// applyPatched replaces target with the patched document
+func applyPatched(c *gin.Context, target interface{}, original, patched []byte, readOnly []string) *PatchError {
+	// Reject changes to read-only fields
+	if fieldErrors := readOnlyViolations(c, original, patched, readOnly); len(fieldErrors) > 0 {
+		return &PatchError{Code: http.StatusBadRequest, Message: "request.invalid_patch", Errors: fieldErrors}
+	}
+
+	// Decode into a zero value so removed members are cleared, keeping fields hidden from JSON
+	value := reflect.ValueOf(target).Elem()
+	result := reflect.New(value.Type())
+	if err := json.Unmarshal(patched, result.Interface()); err != nil {
+		return &PatchError{Code: http.StatusBadRequest, Message: "request.invalid_json", Errors: map[string][]string{"_json": {err.Error()}}}
+	}
+	copyHiddenFields(result.Elem(), value)
+	value.Set(result.Elem())
+	return nil
+}
+
+// readOnlyViolations returns an error for each read-only field that differs between both documents
+func readOnlyViolations(c *gin.Context, original, patched []byte, readOnly []string) map[string][]string {
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(original, &before); err != nil {
+		return map[string][]string{"_json": {err.Error()}}
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return map[string][]string{"_json": {err.Error()}}
+	}
+
+	fieldErrors := make(map[string][]string)
+	for _, field := range readOnly {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			fieldErrors[field] = append(fieldErrors[field], i18n.T(i18n.FromContext(c), "validation.readonly", field))
+		}
+	}
+	return fieldErrors
+}
+
+// copyHiddenFields copies struct fields excluded from JSON from src to dst
+func copyHiddenFields(dst, src reflect.Value) {
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Type().Field(i)
+		switch {
+		case !field.IsExported():
+			continue
+		case field.Anonymous && field.Type.Kind() == reflect.Struct:
+			copyHiddenFields(dst.Field(i), src.Field(i))
+		case field.Tag.Get("json") == "-":
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"fmt"
+	"microservice/config"
+	"microservice/i18n"
+	"microservice/models"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReservedParams are query parameters that are never interpreted as filters
+var ReservedParams = map[string]bool{
+	"page":       true,
+	"limit":      true,
+	"sort":       true,
+	"lang":       true,
+	"fields":     true,
+	"expand":     true,
+	"cursor":     true,
+	"pagination": true,
+	"count":      true,
+	"format":     true,
+	"trashed":    true,
+	"ids":        true, // Legacy comma-separated ID filter, same as id[in]
+	"group":      true, // Comma-separated group IDs, matching their effective members
+}
+
+// operators maps filter operators to their SQL condition
+var operators = map[string]string{
+	"eq":      "%s = ?",
+	"ne":      "%s <> ?",
+	"gt":      "%s > ?",
+	"gte":     "%s >= ?",
+	"lt":      "%s < ?",
+	"lte":     "%s <= ?",
+	"like":    "%s LIKE ? ESCAPE '!'",
+	"in":      "%s IN (?)",
+	"between": "%s BETWEEN ? AND ?",
+}
+
+// filterParamPattern matches filters like "age[gte]", fields of JSON columns being dotted like "metadata.team"
+var filterParamPattern = regexp.MustCompile(`^([a-z_]+(?:\.[a-z0-9_]+)?)(?:\[([a-z]+)\])?$`)
+
+// Filter is a single condition parsed from the query string
+type Filter struct {
+	Column   string
+	Operator string
+	Values   []interface{}
+}
+
+// SortField is a single ordering parsed from the sort parameter
+type SortField struct {
+	Column string
+	Kind   models.FieldKind
+	Desc   bool
+}
+
+// ListQuery holds the filters and ordering requested for a list endpoint
+type ListQuery struct {
+	Filters []Filter
+	Sort    []SortField
+	secret  []byte // Key signing the pagination cursors
+}
+
+// ParseListQuery parses filters like "age[gte]=18" and "sort=-created_at,name" against
+// the fields declared by the model. Unknown fields, operators and invalid values are
+// returned as field errors keyed by query parameter.
+func ParseListQuery(c *gin.Context, model models.Queryable) (*ListQuery, map[string][]string) {
+	fields := model.QueryFields()
+	locale := i18n.FromContext(c)
+	cfg := config.FromContext(c)
+	query := &ListQuery{secret: cfg.API.SigningKey(cfg.Auth)}
+	errors := make(map[string][]string)
+
+	// Parse filters in a stable order
+	params := c.Request.URL.Query()
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if ReservedParams[key] {
+			continue
+		}
+		match := filterParamPattern.FindStringSubmatch(key)
+		if match == nil {
+			errors[key] = append(errors[key], i18n.T(locale, "query.unknown_field", key))
+			continue
+		}
+		field, ok := fields[match[1]]
+		if !ok || !field.Filterable {
+			errors[key] = append(errors[key], i18n.T(locale, "query.unknown_field", match[1]))
+			continue
+		}
+		operator := match[2]
+		if operator == "" {
+			operator = "eq"
+		}
+		if _, ok := operators[operator]; !ok || (operator == "like" && field.Kind != models.StringField) {
+			errors[key] = append(errors[key], i18n.T(locale, "query.unknown_operator", operator))
+			continue
+		}
+
+		for _, raw := range params[key] {
+			values, err := parseFilterValues(field.Kind, operator, raw)
+			if err != nil {
+				errors[key] = append(errors[key], i18n.T(locale, "query.invalid_value", raw))
+				continue
+			}
+			query.Filters = append(query.Filters, Filter{Column: field.Column, Operator: operator, Values: values})
+		}
+	}
+
+	// Parse the legacy comma-separated ID filter like id[in]
+	if raw := c.Query("ids"); raw != "" {
+		values, err := parseFilterValues(models.IntField, "in", raw)
+		if err != nil {
+			errors["ids"] = append(errors["ids"], i18n.T(locale, "query.invalid_value", raw))
+		} else {
+			query.Filters = append(query.Filters, Filter{Column: "id", Operator: "in", Values: values})
+		}
+	}
+
+	// Parse the comma-separated sort fields, descending when prefixed with "-"
+	if raw := c.Query("sort"); raw != "" {
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			desc := strings.HasPrefix(name, "-")
+			name = strings.TrimPrefix(name, "-")
+			field, ok := fields[name]
+			if !ok || !field.Sortable {
+				errors["sort"] = append(errors["sort"], i18n.T(locale, "query.unsortable_field", name))
+				continue
+			}
+			query.Sort = append(query.Sort, SortField{Column: field.Column, Kind: field.Kind, Desc: desc})
+		}
+	}
+
+	if len(errors) > 0 {
+		return nil, errors
+	}
+	return query, nil
+}
+
+// Filter adds the filter conditions to the database query
+func (q *ListQuery) Filter(db *gorm.DB) *gorm.DB {
+	for _, filter := range q.Filters {
+		db = db.Where(fmt.Sprintf(operators[filter.Operator], filter.Column), filter.Values...)
+	}
+	return db
+}
+
+// Order adds the requested ordering to the database query.
+// The primary key is always appended to the ordering so that pages are stable.
+func (q *ListQuery) Order(db *gorm.DB) *gorm.DB {
+	return q.order(db, false)
+}
+
+// SortColumns returns the columns the results are ordered by
+func (q *ListQuery) SortColumns() []string {
+	var columns []string
+	for _, field := range q.keys() {
+		columns = append(columns, field.Column)
+	}
+	return columns
+}
+
+// keys returns the sort fields with the primary key appended so that the ordering is total
+func (q *ListQuery) keys() []SortField {
+	for _, field := range q.Sort {
+		if field.Column == "id" {
+			return q.Sort
+		}
+	}
+	return append(append([]SortField{}, q.Sort...), SortField{Column: "id", Kind: models.IntField})
+}
+
+// order adds the ordering of the sort keys to the query, optionally reversed
+func (q *ListQuery) order(db *gorm.DB, reverse bool) *gorm.DB {
+	for _, field := range q.keys() {
+		direction := "ASC"
+		if field.Desc != reverse {
+			direction = "DESC"
+		}
+		db = db.Order(field.Column + " " + direction)
+	}
+	return db
+}
+
+// parseFilterValues converts the raw query value into the arguments of the operator
+func parseFilterValues(kind models.FieldKind, operator, raw string) ([]interface{}, error) {
+	switch operator {
+	case "in":
+		var list []interface{}
+		for _, item := range strings.Split(raw, ",") {
+			value, err := parseFilterValue(kind, item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return []interface{}{list}, nil
+	case "between":
+		bounds := strings.Split(raw, ",")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("between expects two values")
+		}
+		lower, err := parseFilterValue(kind, bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		upper, err := parseFilterValue(kind, bounds[1])
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{lower, upper}, nil
+	case "like":
+		// Escape LIKE wildcards and use "*" as the client-facing wildcard. The escape character
+		// is "!" rather than a backslash, whose meaning in string literals differs between databases.
+		pattern := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_", "*", "%").Replace(raw)
+		return []interface{}{pattern}, nil
+	default:
+		value, err := parseFilterValue(kind, raw)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{value}, nil
+	}
+}
+
+// parseFilterValue converts a single raw value according to the field kind
+func parseFilterValue(kind models.FieldKind, raw string) (interface{}, error) {
+	raw = strings.TrimSpace(raw)
+	switch kind {
+	case models.IntField:
+		return strconv.Atoi(raw)
+	case models.FloatField:
+		return strconv.ParseFloat(raw, 64)
+	case models.BoolField:
+		return strconv.ParseBool(raw)
+	case models.TimeField:
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			return t, nil
+		}
+		return time.Parse("2006-01-02", raw)
+	default:
+		return raw, nil
+	}
+}
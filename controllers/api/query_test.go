@@ -0,0 +1,62 @@
+package api
+
+import (
+	"microservice/models"
+	"sort"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLikeFilterEscapesWildcards(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type Name struct {
+		Value string
+	}
+	if err := db.AutoMigrate(&Name{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"100%", "1000", "a_b", "axb", "a!b", `a\b`} {
+		if err := db.Create(&Name{Value: value}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		raw  string
+		want []string
+	}{
+		{"100%", []string{"100%"}},
+		{"a_b", []string{"a_b"}},
+		{"a!b", []string{"a!b"}},
+		{`a\b`, []string{`a\b`}},
+		{"a*b", []string{"a!b", `a\b`, "a_b", "axb"}},
+		{"10*", []string{"100%", "1000"}},
+	}
+	for _, test := range tests {
+		values, err := parseFilterValues(models.StringField, "like", test.raw)
+		if err != nil {
+			t.Fatalf("parseFilterValues(%q): %v", test.raw, err)
+		}
+		query := &ListQuery{Filters: []Filter{{Column: "value", Operator: "like", Values: values}}}
+		var got []string
+		if err := query.Filter(db.Model(&Name{})).Pluck("value", &got).Error; err != nil {
+			t.Fatalf("filtering %q: %v", test.raw, err)
+		}
+		sort.Strings(got)
+		if len(got) != len(test.want) {
+			t.Errorf("like %q = %q, want %q", test.raw, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("like %q = %q, want %q", test.raw, got, test.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"microservice/models"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Formats of exported and imported records
+const (
+	CSVFormat    = "csv"
+	NDJSONFormat = "ndjson"
+)
+
+// MaxImportSize is the maximum size in bytes of an imported file
+const MaxImportSize = 32 << 20
+
+// transferContentTypes maps each format to its media type
+var transferContentTypes = map[string]string{
+	CSVFormat:    "text/csv",
+	NDJSONFormat: "application/x-ndjson",
+}
+
+// ExportFormat returns the format requested with ?format=, CSV by default
+func ExportFormat(c *gin.Context) (string, bool) {
+	format := c.DefaultQuery("format", CSVFormat)
+	_, ok := transferContentTypes[format]
+	return format, ok
+}
+
+// ImportFormat returns the format of the request body, given by ?format= or the content type
+func ImportFormat(c *gin.Context) (string, bool) {
+	if format := c.Query("format"); format != "" {
+		_, ok := transferContentTypes[format]
+		return format, ok
+	}
+	for format, contentType := range transferContentTypes {
+		if c.ContentType() == contentType {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// RecordWriter streams records to the response as CSV or NDJSON
+type RecordWriter struct {
+	c       *gin.Context
+	format  string
+	columns []string
+	csv     *csv.Writer
+	buffer  *bufio.Writer
+	count   int
+}
+
+// NewRecordWriter starts an attachment response of records restricted to the JSON fields in columns.
+// CSV responses start with a header row of the column names.
+func NewRecordWriter(c *gin.Context, format, filename string, columns []string) (*RecordWriter, error) {
+	c.Header("Content-Type", transferContentTypes[format]+"; charset=utf-8")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename + "." + format}))
+	c.Status(http.StatusOK)
+
+	w := &RecordWriter{c: c, format: format, columns: columns, buffer: bufio.NewWriter(c.Writer)}
+	if format == CSVFormat {
+		w.csv = csv.NewWriter(w.buffer)
+		if err := w.csv.Write(columns); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Write writes a record and flushes it to the client every 100 records
+func (w *RecordWriter) Write(record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return err
+	}
+
+	if w.format == CSVFormat {
+		row := make([]string, len(w.columns))
+		for i, column := range w.columns {
+			switch value := fields[column].(type) {
+			case nil:
+			case map[string]interface{}, []interface{}:
+				// Objects and arrays are written as JSON
+				var encoded []byte
+				if encoded, err = json.Marshal(value); err != nil {
+					return err
+				}
+				row[i] = string(encoded)
+			default:
+				row[i] = fmt.Sprint(value)
+			}
+		}
+		err = w.csv.Write(row)
+	} else {
+		row := make(map[string]interface{}, len(w.columns))
+		for _, column := range w.columns {
+			row[column] = fields[column]
+		}
+		var line []byte
+		if line, err = json.Marshal(row); err == nil {
+			_, err = w.buffer.Write(append(line, '\n'))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if w.count++; w.count%100 == 0 {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush sends the buffered records to the client
+func (w *RecordWriter) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := w.buffer.Flush(); err != nil {
+		return err
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+// ImportRow is a record read from an imported file
+type ImportRow struct {
+	Line int             // Line of the record in the file
+	Data json.RawMessage // Record as a JSON object
+	Err  error           // Error reading the record, if any
+}
+
+// ReadImportRows reads the records of an imported file as JSON objects. CSV files must start
+// with a header row naming the JSON fields; values are converted according to the field kinds.
+func ReadImportRows(data []byte, format string, fields map[string]models.QueryField) ([]ImportRow, error) {
+	if format == NDJSONFormat {
+		var rows []ImportRow
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			row := ImportRow{Line: i + 1, Data: json.RawMessage(line)}
+			if !json.Valid(row.Data) {
+				row.Err = fmt.Errorf("invalid JSON")
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var row ImportRow
+		var parseErr *csv.ParseError
+		switch {
+		case err == nil:
+			row.Line, _ = reader.FieldPos(0)
+			row.Data, row.Err = csvRecordJSON(header, record, fields)
+		case errors.As(err, &parseErr):
+			row.Line, row.Err = parseErr.StartLine, parseErr.Err
+		default:
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// csvRecordJSON converts a CSV record to a JSON object, skipping empty values
+func csvRecordJSON(header, record []string, fields map[string]models.QueryField) (json.RawMessage, error) {
+	if len(record) != len(header) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(header), len(record))
+	}
+	object := make(map[string]interface{}, len(header))
+	for i, name := range header {
+		raw := strings.TrimSpace(record[i])
+		if raw == "" {
+			continue
+		}
+		switch fields[name].Kind {
+		case models.IntField:
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid number %q", name, raw)
+			}
+			object[name] = value
+		case models.TimeField:
+			value, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid time %q", name, raw)
+			}
+			object[name] = value
+		case models.JSONField:
+			var value interface{}
+			if err := json.Unmarshal([]byte(raw), &value); err != nil {
+				return nil, fmt.Errorf("%s: invalid JSON %q", name, raw)
+			}
+			object[name] = value
+		default:
+			object[name] = raw
+		}
+	}
+	return json.Marshal(object)
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"microservice/i18n"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Values of the trashed parameter
+const (
+	TrashedWith = "with" // Include soft-deleted records
+	TrashedOnly = "only" // Only soft-deleted records
+)
+
+// Trashed includes soft-deleted records in the query as requested with ?trashed=with|only.
+// Invalid values are returned as field errors.
+func Trashed(c *gin.Context, db *gorm.DB) (*gorm.DB, map[string][]string) {
+	switch trashed := c.Query("trashed"); trashed {
+	case "":
+		return db, nil
+	case TrashedWith:
+		return db.Unscoped(), nil
+	case TrashedOnly:
+		return db.Unscoped().Where("deleted_at IS NOT NULL"), nil
+	default:
+		return db, map[string][]string{"trashed": {i18n.T(i18n.FromContext(c), "query.invalid_value", trashed)}}
+	}
+}
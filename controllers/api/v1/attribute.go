@@ -0,0 +1,228 @@
+package v1
+
+import (
+	"microservice/controllers/api"
+	"microservice/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AttributeHandler handles the endpoints of the attribute schema
+type AttributeHandler struct {
+	db *gorm.DB
+}
+
+// NewAttributeHandler returns the attribute handlers, storing attributes in db
+func NewAttributeHandler(db *gorm.DB) *AttributeHandler {
+	return &AttributeHandler{db: db}
+}
+
+// ListAttributes godoc
+// @Summary Get the custom user attributes
+// @Description Get the schema of the custom attributes stored in the metadata of users, ordered by name
+// @Tags attributes
+// @Accept  json
+// @Produce  json
+// @Param page query int false "Page number"
+// @Param limit query int false "Number of items per page"
+// @Success 200 {object} api.ListResponse{data=[]models.Attribute}
+// @Failure 400 {object} object "message: Invalid pagination parameters"
+// @Router /attributes [get]
+func (h *AttributeHandler) ListAttributes(c *gin.Context) {
+	// Validate pagination parameters
+	page, limit, errors := api.ValidateAndParsePagination(c)
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_pagination", errors)
+		return
+	}
+
+	// Fetch the page of attributes and their total count
+	db := h.db.WithContext(c.Request.Context())
+	var attributes []models.Attribute
+	var count int64
+	if err := db.Model(&models.Attribute{}).Count(&count).Error; err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "attribute.fetch_failed")
+		return
+	}
+	total := int(count)
+	if err := db.Order("name").Limit(limit).Offset((page - 1) * limit).Find(&attributes).Error; err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "attribute.fetch_failed")
+		return
+	}
+
+	// Create pagination metadata and response object
+	pagination := api.GetPagination(c, page, limit, &total, page*limit < total)
+	response := api.ListResponse{
+		Data:       attributes,
+		Pagination: pagination,
+	}
+
+	api.SetPaginationHeaders(c, pagination)
+	api.RespondWithETag(c, http.StatusOK, api.ETagOf(response), response)
+}
+
+// GetAttribute godoc
+// @Summary Get a custom user attribute by ID
+// @Description Get the definition of a custom user attribute by ID
+// @Tags attributes
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Attribute ID"
+// @Success 200 {object} models.Attribute
+// @Failure 400 {object} object "message: Invalid attribute ID"
+// @Failure 404 {object} object "message: Attribute not found"
+// @Failure 410 {object} object "message: Attribute was deleted"
+// @Router /attributes/{id} [get]
+func (h *AttributeHandler) GetAttribute(c *gin.Context) {
+	var attribute models.Attribute
+	if !api.Lookup(c, h.db, &attribute, "attribute", false) {
+		return
+	}
+	api.RespondWithETag(c, http.StatusOK, attribute.ETag, attribute)
+}
+
+// CreateAttribute godoc
+// @Summary Define a custom user attribute
+// @Description Define a custom attribute users can store in their metadata. Values are checked against the
+// @Description type and the optional validation rules, such as "max=64" or "oneof=red green", on every write.
+// @Description Attributes with a read scope are only returned and filterable for clients granted that scope.
+// @Tags attributes
+// @Accept  json
+// @Produce  json
+// @Param attribute body models.Attribute true "Attribute"
+// @Param Idempotency-Key header string false "Key making retries of the request return the first response"
+// @Security BearerToken
+// @Success 200 {object} models.Attribute
+// @Failure 400 {object} object "message: Invalid attribute"
+// @Router /attributes [post]
+func (h *AttributeHandler) CreateAttribute(c *gin.Context) {
+	var attribute models.Attribute
+
+	// Validate JSON request body
+	if errMap := attribute.ValidateJSONRequestAndFields(c, h.db, &attribute); len(errMap) > 0 {
+		errors := attribute.AdjustFieldErrors(errMap)
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
+		return
+	}
+
+	// Create attribute in the database
+	attribute.Base = models.Base{}
+	if err := h.db.WithContext(c.Request.Context()).Create(&attribute).Error; err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "attribute.create_failed")
+		return
+	}
+
+	// Return the created attribute as JSON response
+	api.RespondWithJSON(c, http.StatusOK, attribute)
+}
+
+// UpdateAttribute godoc
+// @Summary Replace a custom user attribute
+// @Description Replace the definition of a custom user attribute by ID. The name cannot change.
+// @Description Stored values are not migrated; they are checked against the new definition when users are next written.
+// @Tags attributes
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Attribute ID"
+// @Param attribute body models.Attribute true "Attribute"
+// @Param If-Match header string false "ETag of the attribute being replaced"
+// @Security BearerToken
+// @Success 200 {object} models.Attribute
+// @Failure 400 {object} object "message: Invalid attribute"
+// @Failure 404 {object} object "message: Attribute not found"
+// @Failure 410 {object} object "message: Attribute was deleted"
+// @Failure 412 {object} object "message: Precondition failed"
+// @Router /attributes/{id} [put]
+func (h *AttributeHandler) UpdateAttribute(c *gin.Context) {
+	// Check if attribute exists
+	var attribute models.Attribute
+	if !api.Lookup(c, h.db, &attribute, "attribute", false) {
+		return
+	}
+
+	// Check the client is replacing the current version
+	if !api.CheckIfMatch(c, attribute.ETag) {
+		return
+	}
+
+	// Decode the replacement, keeping read-only fields from the stored attribute
+	var input models.Attribute
+	if errMap := input.DecodeJSONRequest(c, &input); len(errMap) > 0 {
+		errors := input.AdjustFieldErrors(errMap)
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
+		return
+	}
+	input.Base = attribute.Base
+	input.Name = attribute.Name
+	if errMap := input.ValidateFields(c, h.db, &input); len(errMap) > 0 {
+		errors := input.AdjustFieldErrors(errMap)
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
+		return
+	}
+
+	// Save updated attribute to the database
+	if err := models.SaveVersioned(h.db.WithContext(c.Request.Context()), &input); err != nil {
+		if err == models.ErrVersionConflict {
+			api.RespondWithError(c, http.StatusPreconditionFailed, "request.precondition_failed")
+			return
+		}
+		api.RespondWithError(c, http.StatusInternalServerError, "attribute.update_failed")
+		return
+	}
+
+	// Return the updated attribute as JSON response
+	api.RespondWithETag(c, http.StatusOK, input.ETag, input)
+}
+
+// DeleteAttribute godoc
+// @Summary Delete a custom user attribute
+// @Description Delete a custom user attribute by ID. Stored values are kept but no longer validated,
+// @Description and writes of users holding a value must remove it.
+// @Tags attributes
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Attribute ID"
+// @Param If-Match header string false "ETag of the attribute being deleted"
+// @Security BearerToken
+// @Success 204
+// @Failure 400 {object} object "message: Invalid attribute ID"
+// @Failure 404 {object} object "message: Attribute not found"
+// @Failure 410 {object} object "message: Attribute was deleted"
+// @Failure 412 {object} object "message: Precondition failed"
+// @Router /attributes/{id} [delete]
+func (h *AttributeHandler) DeleteAttribute(c *gin.Context) {
+	// Check if attribute exists and is not deleted already
+	var attribute models.Attribute
+	if !api.Lookup(c, h.db, &attribute, "attribute", false) {
+		return
+	}
+
+	// Check the client is deleting the current version
+	if !api.CheckIfMatch(c, attribute.ETag) {
+		return
+	}
+
+	// Delete the attribute unless it was modified in the meantime
+	result := h.db.WithContext(c.Request.Context()).Where("version = ?", attribute.Version).Delete(&attribute)
+	if result.Error != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "attribute.delete_failed")
+		return
+	}
+	if result.RowsAffected == 0 {
+		api.RespondWithError(c, http.StatusPreconditionFailed, "request.precondition_failed")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// userQueryFields returns the queryable user fields, extended with the attributes the client can read
+// extracted with the SQL dialect of db
+func userQueryFields(db *gorm.DB, schema models.AttributeSchema, hasScope func(scope string) bool) models.QueryFieldSet {
+	fields := models.QueryFieldSet((&models.User{}).QueryFields())
+	for name, field := range schema.QueryFields(db, "metadata", hasScope) {
+		fields[name] = field
+	}
+	return fields
+}
@@ -1,44 +1,141 @@
 package v1
 
 import (
+	"errors"
+	"microservice/config"
+	"microservice/controllers/api"
+	"microservice/models"
+	"microservice/tokens"
 	"net/http"
-	"os"
-	"time"
+	"strconv"
 
-	"github.com/form3tech-oss/jwt-go"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// AuthHandler handles the token endpoint
+type AuthHandler struct {
+	db *gorm.DB
+}
+
+// NewAuthHandler returns the token handler, authenticating users and clients and reading
+// the signing keys from db
+func NewAuthHandler(db *gorm.DB) *AuthHandler {
+	return &AuthHandler{db: db}
+}
+
 // GenerateJWT godoc
 // @Summary Generate a new JWT token
-// @Description Generates a new JWT token for user authentication and authorization
+// @Description Generates a new JWT token for user authentication and authorization.
+// @Description Without username, a token of the dummy user is issued when anonymous tokens are enabled.
+// @Description When username is the email of a user, the token is issued for that user, with the names of the groups
+// @Description the user belongs to directly or through nested groups in the groups claim. Only active users obtain
+// @Description tokens, by sending the password they set when accepting their invitation.
+// @Description With grant_type client_credentials, the token is issued to the client with the scope it was created with.
 // @Tags authentication
 // @Accept  json
 // @Produce  json
+// @Param grant_type formData string false "password (default) or client_credentials" Enums(password, client_credentials)
+// @Param username formData string false "Email of the user to issue the token for"
+// @Param password formData string false "Password of the user"
+// @Param client_id formData string false "ID of the client, for the client_credentials grant"
+// @Param client_secret formData string false "Secret of the client, for the client_credentials grant"
 // @Success 200 {object} object "token: <generated_token>"
+// @Failure 400 {object} object "message: Unsupported grant type"
+// @Failure 401 {object} object "message: Invalid credentials"
+// @Failure 403 {object} object "message: Account is not active"
 // @Failure 500 {object} object "message: Failed to generate JWT token"
 // @Router /oauth/token [post]
-func GenerateJWT(c *gin.Context) {
-	// Define your JWT claims
-	claims := jwt.MapClaims{
-		"sub":   "dummyuser",
-		"iss":   os.Getenv("AUTH0_DOMAIN"),
-		"aud":   os.Getenv("AUTH0_AUDIENCE"),
-		"exp":   time.Now().Add(time.Hour * 24).Unix(),               // Token expires after 24 hours
-		"scope": "create:users read:users update:users delete:users", // Define the scope of the token for CRUD operations on users
-	}
-
-	// Create JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign the token with a secret
-	secret := os.Getenv("AUTH0_SECRET")
-	signedToken, err := token.SignedString([]byte(secret))
+func (h *AuthHandler) GenerateJWT(c *gin.Context) {
+	var input struct {
+		GrantType    string `form:"grant_type" json:"grant_type"`
+		Username     string `form:"username" json:"username"`
+		Password     string `form:"password" json:"password"`
+		ClientID     string `form:"client_id" json:"client_id"`
+		ClientSecret string `form:"client_secret" json:"client_secret"`
+	}
+	if c.Request.ContentLength != 0 {
+		c.ShouldBind(&input)
+	}
+
+	var claims tokens.Claims
+	switch input.GrantType {
+	case "", "password":
+		var ok bool
+		if claims, ok = h.userClaims(c, input.Username, input.Password); !ok {
+			return
+		}
+	case "client_credentials":
+		// Clients obtain tokens for themselves, with the scope they were created with
+		client, err := models.AuthenticateClient(h.db.WithContext(c.Request.Context()), input.ClientID, input.ClientSecret)
+		if err != nil {
+			if err == models.ErrInvalidClient {
+				api.RespondWithError(c, http.StatusUnauthorized, "auth.invalid_client")
+				return
+			}
+			api.RespondWithError(c, http.StatusInternalServerError, "auth.token_failed")
+			return
+		}
+		claims = tokens.Claims{Subject: client.ClientID, Scope: client.Scope}
+	default:
+		api.RespondWithError(c, http.StatusBadRequest, "auth.unsupported_grant_type")
+		return
+	}
+
+	// Sign the token with the active signing key
+	signedToken, err := tokens.Issue(h.db.WithContext(c.Request.Context()), config.FromContext(c).Auth, claims)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to generate JWT token"})
+		api.RespondWithError(c, http.StatusInternalServerError, "auth.token_failed")
 		return
 	}
 
 	// Return the generated JWT token
 	c.JSON(http.StatusOK, gin.H{"token": signedToken})
 }
+
+// userClaims returns the claims of the token issued for the user with the email, or of the
+// dummy user when no email is given and anonymous tokens are enabled
+func (h *AuthHandler) userClaims(c *gin.Context, email, password string) (tokens.Claims, bool) {
+	claims := tokens.Claims{Subject: "dummyuser", Scope: tokens.DefaultScope}
+	if email == "" {
+		// Otherwise suspended and deactivated users would obtain tokens by leaving out their email
+		if !config.FromContext(c).Auth.AnonymousTokens {
+			api.RespondWithError(c, http.StatusUnauthorized, "auth.invalid_credentials")
+			return claims, false
+		}
+		return claims, true
+	}
+
+	// Only active users with a password matching the one sent obtain tokens
+	if password == "" {
+		api.RespondWithError(c, http.StatusUnauthorized, "auth.invalid_credentials")
+		return claims, false
+	}
+	db := h.db.WithContext(c.Request.Context())
+	var user models.User
+	err := db.Where("email = ?", email).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		api.RespondWithError(c, http.StatusInternalServerError, "auth.token_failed")
+		return claims, false
+	}
+	if err != nil || user.PasswordHash == "" || !user.CheckPassword(password) {
+		api.RespondWithError(c, http.StatusUnauthorized, "auth.invalid_credentials")
+		return claims, false
+	}
+	if !user.CanSignIn() {
+		api.RespondWithError(c, http.StatusForbidden, "auth.account_"+user.Status)
+		return claims, false
+	}
+
+	// List the groups the user belongs to
+	claims.Subject = strconv.FormatUint(uint64(user.ID), 10)
+	ids, err := models.EffectiveGroupIDs(db, user.ID)
+	if err == nil {
+		err = db.Model(&models.Group{}).Where("id IN (?)", ids).Order("name").Pluck("name", &claims.Groups).Error
+	}
+	if err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "auth.token_failed")
+		return claims, false
+	}
+	return claims, true
+}
@@ -0,0 +1,219 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"microservice/controllers/api"
+	"microservice/imaging"
+	"microservice/models"
+	"microservice/services"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxAvatarSize is the maximum size in bytes of an uploaded avatar
+const MaxAvatarSize = 5 << 20
+
+// PutUserAvatar godoc
+// @Summary Upload the avatar of a user
+// @Description Upload a JPEG, PNG or GIF image as the avatar of a user. The type is detected from the content,
+// @Description and the image is cropped to a square and resized to small (64px), medium (256px) and large (512px) thumbnails.
+// @Tags users
+// @Accept  multipart/form-data
+// @Produce  json
+// @Param id path int true "User ID"
+// @Param avatar formData file true "Image of at most 5 MiB"
+// @Param If-Match header string false "ETag of the user"
+// @Security BearerToken
+// @Success 200 {object} models.User
+// @Failure 400 {object} object "message: Invalid image"
+// @Failure 404 {object} object "message: User not found"
+// @Failure 410 {object} object "message: User was deleted"
+// @Failure 412 {object} object "message: Precondition failed"
+// @Failure 413 {object} object "message: Request body is too large"
+// @Failure 415 {object} object "message: Unsupported image type"
+// @Failure 503 {object} object "message: Avatars are unavailable"
+// @Router /users/{id}/avatar [put]
+func (h *UserHandler) PutUserAvatar(c *gin.Context) {
+	if !h.users.AvatarsAvailable() {
+		api.RespondWithError(c, http.StatusServiceUnavailable, "avatar.unavailable")
+		return
+	}
+
+	// Check if user exists and the client is updating its current version
+	user, ok := h.lookup(c, false)
+	if !ok {
+		return
+	}
+	if !api.CheckIfMatch(c, user.ETag) {
+		return
+	}
+
+	// Read the uploaded image, leaving room for the multipart framing
+	data, status, message := readAvatar(c)
+	if status != 0 {
+		api.RespondWithError(c, status, message)
+		return
+	}
+	if _, ok := imaging.Sniff(data); !ok {
+		api.RespondWithError(c, http.StatusUnsupportedMediaType, "avatar.unsupported_type")
+		return
+	}
+	img, err := imaging.Decode(data)
+	if err != nil {
+		api.RespondWithError(c, http.StatusBadRequest, "avatar.invalid_image", map[string][]string{"avatar": {err.Error()}})
+		return
+	}
+
+	// Store the thumbnails and save the new avatar of the user
+	if err := h.users.SetAvatar(c.Request.Context(), user, img); err != nil {
+		if err == models.ErrVersionConflict {
+			api.RespondWithError(c, http.StatusPreconditionFailed, "request.precondition_failed")
+			return
+		}
+		api.RespondWithError(c, http.StatusInternalServerError, "avatar.upload_failed")
+		return
+	}
+
+	h.respondWithUser(c, user)
+}
+
+// GetUserAvatar godoc
+// @Summary Get the avatar of a user
+// @Description Get a thumbnail of the avatar of a user. Requests for the avatar_url of the user can be cached indefinitely.
+// @Tags users
+// @Produce  image/jpeg
+// @Produce  image/png
+// @Param id path int true "User ID"
+// @Param size query string false "Thumbnail size" Enums(small, medium, large) default(medium)
+// @Param If-None-Match header string false "ETag of a cached thumbnail"
+// @Success 200 {file} file "Thumbnail"
+// @Success 304 "Not Modified"
+// @Failure 400 {object} object "message: Invalid thumbnail size"
+// @Failure 404 {object} object "message: User has no avatar"
+// @Failure 410 {object} object "message: User was deleted"
+// @Failure 503 {object} object "message: Avatars are unavailable"
+// @Router /users/{id}/avatar [get]
+func (h *UserHandler) GetUserAvatar(c *gin.Context) {
+	size := c.DefaultQuery("size", imaging.DefaultThumbnail)
+	if _, ok := imaging.ThumbnailSizes[size]; !ok {
+		api.RespondWithError(c, http.StatusBadRequest, "avatar.invalid_size")
+		return
+	}
+	if !h.users.AvatarsAvailable() {
+		api.RespondWithError(c, http.StatusServiceUnavailable, "avatar.unavailable")
+		return
+	}
+
+	// Check if user exists and has an avatar
+	user, ok := h.lookup(c, false)
+	if !ok {
+		return
+	}
+	if user.Avatar == "" {
+		api.RespondWithError(c, http.StatusNotFound, "avatar.not_found")
+		return
+	}
+
+	// Thumbnails never change under a key, so versioned URLs can be cached indefinitely
+	version := path.Base(strings.TrimSuffix(user.Avatar, path.Ext(user.Avatar)))
+	if c.Query("v") == version {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+	if api.NotModified(c, fmt.Sprintf(`"%s-%s"`, version, size)) {
+		return
+	}
+
+	// Stream the thumbnail from the blob store
+	reader, contentType, err := h.users.Avatar(c.Request.Context(), user, size)
+	if err == services.ErrNoAvatar {
+		api.RespondWithError(c, http.StatusNotFound, "avatar.not_found")
+		return
+	}
+	if err != nil {
+		log.Println("Failed to fetch avatar:", err)
+		api.RespondWithError(c, http.StatusInternalServerError, "avatar.fetch_failed")
+		return
+	}
+	defer reader.Close()
+	c.DataFromReader(http.StatusOK, -1, contentType, reader, map[string]string{"X-Content-Type-Options": "nosniff"})
+}
+
+// DeleteUserAvatar godoc
+// @Summary Delete the avatar of a user
+// @Description Remove the avatar of a user and delete its thumbnails
+// @Tags users
+// @Produce  json
+// @Param id path int true "User ID"
+// @Param If-Match header string false "ETag of the user"
+// @Security BearerToken
+// @Success 204
+// @Failure 400 {object} object "message: Invalid user ID"
+// @Failure 404 {object} object "message: User has no avatar"
+// @Failure 410 {object} object "message: User was deleted"
+// @Failure 412 {object} object "message: Precondition failed"
+// @Router /users/{id}/avatar [delete]
+func (h *UserHandler) DeleteUserAvatar(c *gin.Context) {
+	// Check if user exists with an avatar and the client is updating its current version
+	user, ok := h.lookup(c, false)
+	if !ok {
+		return
+	}
+	if user.Avatar == "" {
+		api.RespondWithError(c, http.StatusNotFound, "avatar.not_found")
+		return
+	}
+	if !api.CheckIfMatch(c, user.ETag) {
+		return
+	}
+
+	// Remove the avatar from the user, then delete its thumbnails
+	if err := h.users.RemoveAvatar(c.Request.Context(), user); err != nil {
+		respondWithUserError(c, user, err, "user.update_failed")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// readAvatar reads the avatar file of a multipart upload, returning the status
+// and error code of the response when it cannot be read
+func readAvatar(c *gin.Context) ([]byte, int, string) {
+	if c.ContentType() != gin.MIMEMultipartPOSTForm {
+		return nil, http.StatusUnsupportedMediaType, "request.unsupported_media_type"
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxAvatarSize+1<<20)
+	file, header, err := c.Request.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, http.StatusRequestEntityTooLarge, "request.too_large"
+		}
+		return nil, http.StatusBadRequest, "avatar.missing_file"
+	}
+	defer file.Close()
+	if header.Size > MaxAvatarSize {
+		return nil, http.StatusRequestEntityTooLarge, "request.too_large"
+	}
+	data, err := io.ReadAll(io.LimitReader(file, MaxAvatarSize+1))
+	if err != nil || len(data) > MaxAvatarSize {
+		return nil, http.StatusRequestEntityTooLarge, "request.too_large"
+	}
+	return data, 0, ""
+}
+
+// respondWithUser responds with the user, without the attributes hidden from the client
+func (h *UserHandler) respondWithUser(c *gin.Context, user *models.User) {
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
+	schema.Hide(user.Metadata, hasScope)
+	api.RespondWithETag(c, http.StatusOK, user.ETag, user)
+}
@@ -0,0 +1,501 @@
+package v1
+
+import (
+	"microservice/controllers/api"
+	"microservice/i18n"
+	"microservice/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GroupMemberRequest identifies a user or a group to add to a group
+type GroupMemberRequest struct {
+	Type string `json:"type" binding:"required,oneof=user group"`
+	ID   uint   `json:"id" binding:"required"`
+}
+
+// GroupMember is a member of a group
+type GroupMember struct {
+	Type    string     `json:"type"`               // "user" or "group"
+	ID      uint       `json:"id"`                 // ID of the user or group
+	Name    string     `json:"name"`               // Name of the user or group
+	AddedAt *time.Time `json:"added_at,omitempty"` // When the member was added, for direct members
+}
+
+// GroupHandler handles the group endpoints
+type GroupHandler struct {
+	db *gorm.DB
+}
+
+// NewGroupHandler returns the group handlers, storing groups and their members in db
+func NewGroupHandler(db *gorm.DB) *GroupHandler {
+	return &GroupHandler{db: db}
+}
+
+// ListGroups godoc
+// @Summary Get all groups
+// @Description Get all groups with optional filtering and pagination
+// @Tags groups
+// @Accept  json
+// @Produce  json
+// @Param name query string false "Filter by name, also name[ne], name[like] with * wildcards, name[in]"
+// @Param sort query string false "Comma-separated sort fields, prefixed with - for descending order"
+// @Param page query int false "Page number"
+// @Param limit query int false "Number of items per page"
+// @Success 200 {object} api.ListResponse{data=[]models.Group}
+// @Failure 400 {object} object "message: Invalid query parameters"
+// @Router /groups [get]
+func (h *GroupHandler) ListGroups(c *gin.Context) {
+	// Validate pagination parameters, filters and sort order
+	page, limit, errors := api.ValidateAndParsePagination(c)
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_pagination", errors)
+		return
+	}
+	listQuery, errors := api.ParseListQuery(c, &models.Group{})
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_query", errors)
+		return
+	}
+	query := listQuery.Filter(h.db.WithContext(c.Request.Context())).Session(&gorm.Session{})
+
+	// Fetch the page of groups and their total count
+	var groups []models.Group
+	var count int64
+	if err := query.Model(&models.Group{}).Count(&count).Error; err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "group.fetch_failed")
+		return
+	}
+	total := int(count)
+	if err := listQuery.Order(query).Limit(limit).Offset((page - 1) * limit).Find(&groups).Error; err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "group.fetch_failed")
+		return
+	}
+
+	// Create pagination metadata and response object
+	pagination := api.GetPagination(c, page, limit, &total, page*limit < total)
+	response := api.ListResponse{
+		Data:       groups,
+		Pagination: pagination,
+	}
+
+	api.SetPaginationHeaders(c, pagination)
+	api.RespondWithETag(c, http.StatusOK, api.ETagOf(response), response)
+}
+
+// GetGroup godoc
+// @Summary Get a single group by ID
+// @Description Get a single group by ID
+// @Tags groups
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Group ID"
+// @Success 200 {object} models.Group
+// @Failure 400 {object} object "message: Invalid group ID"
+// @Failure 404 {object} object "message: Group not found"
+// @Failure 410 {object} object "message: Group was deleted"
+// @Router /groups/{id} [get]
+func (h *GroupHandler) GetGroup(c *gin.Context) {
+	var group models.Group
+	if !api.Lookup(c, h.db, &group, "group", false) {
+		return
+	}
+	api.RespondWithETag(c, http.StatusOK, group.ETag, group)
+}
+
+// CreateGroup godoc
+// @Summary Create a new group
+// @Description Create a new group
+// @Tags groups
+// @Accept  json
+// @Produce  json
+// @Param group body models.Group true "Group"
+// @Param Idempotency-Key header string false "Key making retries of the request return the first response"
+// @Security BearerToken
+// @Success 200 {object} models.Group
+// @Failure 400 {object} object "message: Invalid group"
+// @Router /groups [post]
+func (h *GroupHandler) CreateGroup(c *gin.Context) {
+	var group models.Group
+
+	// Validate JSON request body
+	if errMap := group.ValidateJSONRequestAndFields(c, h.db, &group); len(errMap) > 0 {
+		errors := group.AdjustFieldErrors(errMap)
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
+		return
+	}
+
+	// Create group in the database
+	group.Base = models.Base{}
+	if err := h.db.WithContext(c.Request.Context()).Create(&group).Error; err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "group.create_failed")
+		return
+	}
+
+	// Return the created group as JSON response
+	api.RespondWithJSON(c, http.StatusOK, group)
+}
+
+// UpdateGroup godoc
+// @Summary Replace an existing group
+// @Description Replace an existing group by ID. Read-only fields in the body are ignored.
+// @Tags groups
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Group ID"
+// @Param group body models.Group true "Group"
+// @Param If-Match header string false "ETag of the group being replaced"
+// @Security BearerToken
+// @Success 200 {object} models.Group
+// @Failure 400 {object} object "message: Invalid group"
+// @Failure 404 {object} object "message: Group not found"
+// @Failure 410 {object} object "message: Group was deleted"
+// @Failure 412 {object} object "message: Precondition failed"
+// @Router /groups/{id} [put]
+func (h *GroupHandler) UpdateGroup(c *gin.Context) {
+	// Check if group exists
+	var group models.Group
+	if !api.Lookup(c, h.db, &group, "group", false) {
+		return
+	}
+
+	// Check the client is replacing the current version
+	if !api.CheckIfMatch(c, group.ETag) {
+		return
+	}
+
+	// Decode the replacement, keeping read-only fields from the stored group
+	var input models.Group
+	if errMap := input.DecodeJSONRequest(c, &input); len(errMap) > 0 {
+		errors := input.AdjustFieldErrors(errMap)
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
+		return
+	}
+	input.Base = group.Base
+	if errMap := input.ValidateFields(c, h.db, &input); len(errMap) > 0 {
+		errors := input.AdjustFieldErrors(errMap)
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
+		return
+	}
+
+	// Save updated group to the database
+	if err := models.SaveVersioned(h.db.WithContext(c.Request.Context()), &input); err != nil {
+		if err == models.ErrVersionConflict {
+			api.RespondWithError(c, http.StatusPreconditionFailed, "request.precondition_failed")
+			return
+		}
+		api.RespondWithError(c, http.StatusInternalServerError, "group.update_failed")
+		return
+	}
+
+	// Return the updated group as JSON response
+	api.RespondWithETag(c, http.StatusOK, input.ETag, input)
+}
+
+// DeleteGroup godoc
+// @Summary Delete a group
+// @Description Delete a group by ID. Its members no longer belong to the groups containing it.
+// @Tags groups
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Group ID"
+// @Param If-Match header string false "ETag of the group being deleted"
+// @Security BearerToken
+// @Success 204
+// @Failure 400 {object} object "message: Invalid group ID"
+// @Failure 404 {object} object "message: Group not found"
+// @Failure 410 {object} object "message: Group was deleted"
+// @Failure 412 {object} object "message: Precondition failed"
+// @Router /groups/{id} [delete]
+func (h *GroupHandler) DeleteGroup(c *gin.Context) {
+	// Check if group exists and is not deleted already
+	var group models.Group
+	if !api.Lookup(c, h.db, &group, "group", false) {
+		return
+	}
+
+	// Check the client is deleting the current version
+	if !api.CheckIfMatch(c, group.ETag) {
+		return
+	}
+
+	// Delete the group unless it was modified in the meantime
+	result := h.db.WithContext(c.Request.Context()).Where("version = ?", group.Version).Delete(&group)
+	if result.Error != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "group.delete_failed")
+		return
+	}
+	if result.RowsAffected == 0 {
+		api.RespondWithError(c, http.StatusPreconditionFailed, "request.precondition_failed")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroupMembers godoc
+// @Summary Get the members of a group
+// @Description Get the users and groups directly in a group, or with effective=true every user
+// @Description belonging to the group directly or through its nested groups
+// @Tags groups
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Group ID"
+// @Param effective query bool false "List the users of nested groups as well"
+// @Param page query int false "Page number"
+// @Param limit query int false "Number of items per page"
+// @Success 200 {object} api.ListResponse{data=[]GroupMember}
+// @Failure 400 {object} object "message: Invalid group ID"
+// @Failure 404 {object} object "message: Group not found"
+// @Failure 410 {object} object "message: Group was deleted"
+// @Router /groups/{id}/members [get]
+func (h *GroupHandler) ListGroupMembers(c *gin.Context) {
+	// Validate pagination parameters and check if group exists
+	page, limit, errors := api.ValidateAndParsePagination(c)
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_pagination", errors)
+		return
+	}
+	var group models.Group
+	if !api.Lookup(c, h.db, &group, "group", false) {
+		return
+	}
+
+	db := h.db.WithContext(c.Request.Context())
+	var members []GroupMember
+	var total int
+	var err error
+	if effective, _ := strconv.ParseBool(c.Query("effective")); effective {
+		members, total, err = effectiveGroupMembers(db, group.ID, page, limit)
+	} else {
+		members, total, err = directGroupMembers(db, group.ID, page, limit)
+	}
+	if err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "group.fetch_failed")
+		return
+	}
+
+	// Create pagination metadata and response object
+	pagination := api.GetPagination(c, page, limit, &total, page*limit < total)
+	response := api.ListResponse{
+		Data:       members,
+		Pagination: pagination,
+	}
+
+	api.SetPaginationHeaders(c, pagination)
+	api.RespondWithJSON(c, http.StatusOK, response)
+}
+
+// AddGroupMember godoc
+// @Summary Add a member to a group
+// @Description Add a user or a group as a direct member of a group. A group cannot contain itself,
+// @Description directly or through its nested groups.
+// @Tags groups
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Group ID"
+// @Param member body GroupMemberRequest true "Member"
+// @Security BearerToken
+// @Success 201 {object} GroupMember
+// @Failure 400 {object} object "message: Invalid member"
+// @Failure 404 {object} object "message: Group not found"
+// @Failure 409 {object} object "message: Membership would create a cycle"
+// @Failure 410 {object} object "message: Group was deleted"
+// @Router /groups/{id}/members [post]
+func (h *GroupHandler) AddGroupMember(c *gin.Context) {
+	// Check if group exists
+	var group models.Group
+	if !api.Lookup(c, h.db, &group, "group", false) {
+		return
+	}
+
+	// Validate JSON request body
+	var input GroupMemberRequest
+	var base models.Base
+	if errMap := base.ValidateJSONRequestAndFields(c, h.db, &input); len(errMap) > 0 {
+		errors := base.AdjustFieldErrors(errMap, "GroupMemberRequest")
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
+		return
+	}
+
+	// Check the member exists
+	db := h.db.WithContext(c.Request.Context())
+	member := GroupMember{Type: input.Type, ID: input.ID}
+	var err error
+	if input.Type == models.UserMember {
+		var user models.User
+		if err = models.FindByID(db, &user, input.ID, false); err == nil {
+			member.Name = user.Name
+		}
+	} else {
+		var nested models.Group
+		if err = models.FindByID(db, &nested, input.ID, false); err == nil {
+			member.Name = nested.Name
+		}
+	}
+	if err != nil {
+		code, message := api.LookupStatus(err, input.Type)
+		api.RespondWithError(c, code, message)
+		return
+	}
+
+	// Add the member unless it already is one or would create a cycle
+	switch err := models.AddGroupMember(db, group.ID, input.Type, input.ID); err {
+	case nil:
+	case models.ErrAlreadyMember:
+		api.RespondWithError(c, http.StatusConflict, "group.already_member")
+		return
+	case models.ErrGroupCycle:
+		api.RespondWithError(c, http.StatusConflict, "group.cycle")
+		return
+	default:
+		api.RespondWithError(c, http.StatusInternalServerError, "group.update_failed")
+		return
+	}
+
+	now := time.Now()
+	member.AddedAt = &now
+	api.RespondWithJSON(c, http.StatusCreated, member)
+}
+
+// RemoveGroupMember godoc
+// @Summary Remove a member from a group
+// @Description Remove a direct member of a group
+// @Tags groups
+// @Produce  json
+// @Param id path int true "Group ID"
+// @Param type path string true "Member type" Enums(user, group)
+// @Param member_id path int true "User or group ID"
+// @Security BearerToken
+// @Success 204
+// @Failure 400 {object} object "message: Invalid member"
+// @Failure 404 {object} object "message: Not a member of the group"
+// @Failure 410 {object} object "message: Group was deleted"
+// @Router /groups/{id}/members/{type}/{member_id} [delete]
+func (h *GroupHandler) RemoveGroupMember(c *gin.Context) {
+	// Check if group exists
+	var group models.Group
+	if !api.Lookup(c, h.db, &group, "group", false) {
+		return
+	}
+
+	// Validate the member
+	memberType := c.Param("type")
+	memberID, err := strconv.ParseUint(c.Param("member_id"), 10, 0)
+	if (memberType != models.UserMember && memberType != models.GroupMember) || err != nil || memberID == 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "group.invalid_member")
+		return
+	}
+
+	// Remove the member
+	removed, err := models.RemoveGroupMember(h.db.WithContext(c.Request.Context()), group.ID, memberType, uint(memberID))
+	if err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "group.update_failed")
+		return
+	}
+	if !removed {
+		api.RespondWithError(c, http.StatusNotFound, "group.not_member")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// directGroupMembers returns a page of the users and groups directly in a group and their total count
+func directGroupMembers(db *gorm.DB, groupID uint, page, limit int) ([]GroupMember, int, error) {
+	query := db.Model(&models.GroupMembership{}).Where("group_id = ?", groupID).Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var memberships []models.GroupMembership
+	err := query.Order("member_type DESC, member_id").Limit(limit).Offset((page - 1) * limit).Find(&memberships).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Load the names of the members, including soft-deleted ones so that they can be removed
+	ids := map[string][]uint{}
+	for _, membership := range memberships {
+		ids[membership.MemberType] = append(ids[membership.MemberType], membership.MemberID)
+	}
+	names := map[string]map[uint]string{models.UserMember: {}, models.GroupMember: {}}
+	var users []models.User
+	var groups []models.Group
+	if err := db.Unscoped().Where("id IN (?)", ids[models.UserMember]).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := db.Unscoped().Where("id IN (?)", ids[models.GroupMember]).Find(&groups).Error; err != nil {
+		return nil, 0, err
+	}
+	for _, user := range users {
+		names[models.UserMember][user.ID] = user.Name
+	}
+	for _, group := range groups {
+		names[models.GroupMember][group.ID] = group.Name
+	}
+
+	members := make([]GroupMember, len(memberships))
+	for i, membership := range memberships {
+		addedAt := membership.CreatedAt
+		members[i] = GroupMember{
+			Type:    membership.MemberType,
+			ID:      membership.MemberID,
+			Name:    names[membership.MemberType][membership.MemberID],
+			AddedAt: &addedAt,
+		}
+	}
+	return members, int(total), nil
+}
+
+// effectiveGroupMembers returns a page of the users belonging to a group directly or through
+// nested groups and their total count
+func effectiveGroupMembers(db *gorm.DB, groupID uint, page, limit int) ([]GroupMember, int, error) {
+	ids, err := models.EffectiveMemberIDs(db, groupID)
+	if err != nil {
+		return nil, 0, err
+	}
+	query := db.Model(&models.User{}).Where("id IN (?)", ids).Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []models.User
+	if err := query.Order("id").Limit(limit).Offset((page - 1) * limit).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	members := make([]GroupMember, len(users))
+	for i, user := range users {
+		members[i] = GroupMember{Type: models.UserMember, ID: user.ID, Name: user.Name}
+	}
+	return members, int(total), nil
+}
+
+// filterByGroup restricts a user query to the effective members of any of the groups
+// listed in the comma-separated group parameter. It responds with 400 Bad Request for
+// invalid group IDs and reports whether the query can proceed.
+func filterByGroup(c *gin.Context, db, query *gorm.DB) (*gorm.DB, bool) {
+	raw := c.Query("group")
+	if raw == "" {
+		return query, true
+	}
+	var members []uint
+	for _, item := range strings.Split(raw, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(item), 10, 0)
+		if err != nil || id == 0 {
+			errors := map[string][]string{"group": {i18n.T(i18n.FromContext(c), "query.invalid_value", item)}}
+			api.RespondWithError(c, http.StatusBadRequest, "request.invalid_query", errors)
+			return nil, false
+		}
+		ids, err := models.EffectiveMemberIDs(db, uint(id))
+		if err != nil {
+			api.RespondWithError(c, http.StatusInternalServerError, "group.fetch_failed")
+			return nil, false
+		}
+		members = append(members, ids...)
+	}
+	return query.Where("id IN (?)", members), true
+}
@@ -0,0 +1,65 @@
+package v1
+
+import (
+	"context"
+	"microservice/controllers/api"
+	"microservice/database"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// healthTimeout bounds how long the health check waits for the database
+const healthTimeout = 2 * time.Second
+
+// Health reports the status of the service and its dependencies
+type Health struct {
+	Status   string `json:"status" enums:"ok"`
+	Database string `json:"database" enums:"ok"`
+}
+
+// HealthHandler handles the health check
+type HealthHandler struct {
+	db *gorm.DB
+	// draining is set when the service shuts down
+	draining atomic.Bool
+}
+
+// NewHealthHandler returns the health check handler, pinging db
+func NewHealthHandler(db *gorm.DB) *HealthHandler {
+	return &HealthHandler{db: db}
+}
+
+// Drain makes health checks fail, for load balancers to stop routing requests to the service
+// before it shuts down
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// HealthCheck godoc
+// @Summary Check the health of the service
+// @Description Ping the database, for load balancer and orchestrator probes. Fails once the service shuts down.
+// @Tags health
+// @Produce  json
+// @Success 200 {object} Health
+// @Failure 503 {object} object "message: Database is unavailable or service is shutting down"
+// @Router /health [get]
+func (h *HealthHandler) HealthCheck(c *gin.Context) {
+	if h.draining.Load() {
+		api.RespondWithError(c, http.StatusServiceUnavailable, "health.shutting_down")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthTimeout)
+	defer cancel()
+
+	if err := database.Ping(ctx, h.db); err != nil {
+		api.RespondWithError(c, http.StatusServiceUnavailable, "health.database_unavailable")
+		return
+	}
+
+	api.RespondWithJSON(c, http.StatusOK, Health{Status: "ok", Database: "ok"})
+}
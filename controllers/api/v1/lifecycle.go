@@ -0,0 +1,212 @@
+package v1
+
+import (
+	"errors"
+	"microservice/controllers/api"
+	"microservice/i18n"
+	"microservice/models"
+	"microservice/services"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StatusRequest changes the status of a user
+type StatusRequest struct {
+	Status string     `json:"status" binding:"required,oneof=active suspended deactivated"`
+	Reason string     `json:"reason" binding:"required_if=Status suspended,max=500"`
+	Until  *time.Time `json:"until" binding:"omitempty,future"`
+}
+
+// AcceptInvitationRequest sets the password of an invited user
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// Invitation is an invited user with the token letting them set their password.
+// The token is only returned when the invitation is issued.
+type Invitation struct {
+	User      *models.User `json:"user"`
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
+
+// ChangeUserStatus godoc
+// @Summary Change the status of a user
+// @Description Move a user to another status. Invited users become active by accepting their invitation or
+// @Description through this endpoint, active users can be suspended with a reason and an optional end date,
+// @Description and any user can be deactivated then reactivated. Suspended and deactivated users cannot obtain
+// @Description tokens, and their existing tokens are rejected. Requires the admin:users scope.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param id path int true "User ID"
+// @Param status body StatusRequest true "New status"
+// @Param If-Match header string false "ETag of the user"
+// @Security BearerToken
+// @Success 200 {object} models.User
+// @Failure 400 {object} object "message: Invalid status"
+// @Failure 403 {object} object "message: Insufficient scope"
+// @Failure 404 {object} object "message: User not found"
+// @Failure 409 {object} object "message: Status transition is not allowed"
+// @Failure 410 {object} object "message: User was deleted"
+// @Failure 412 {object} object "message: Precondition failed"
+// @Router /users/{id}/status [post]
+func (h *UserHandler) ChangeUserStatus(c *gin.Context) {
+	// Check if user exists and the client is updating its current version
+	user, ok := h.lookup(c, false)
+	if !ok {
+		return
+	}
+	if !api.CheckIfMatch(c, user.ETag) {
+		return
+	}
+
+	// Validate JSON request body
+	var input StatusRequest
+	var base models.Base
+	if errMap := base.ValidateJSONRequestAndFields(c, nil, &input); len(errMap) > 0 {
+		errors := base.AdjustFieldErrors(errMap, "StatusRequest")
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
+		return
+	}
+
+	// Move the user to the new status if the state machine allows it
+	if err := h.users.ChangeStatus(c.Request.Context(), user, input.Status, input.Reason, input.Until); err != nil {
+		var transition *services.TransitionError
+		if errors.As(err, &transition) {
+			allowed := strings.Join(transition.Allowed, ", ")
+			errors := map[string][]string{"status": {i18n.T(i18n.FromContext(c), "user.allowed_statuses", transition.From, allowed)}}
+			api.RespondWithError(c, http.StatusConflict, "user.invalid_transition", errors)
+			return
+		}
+		respondWithUserError(c, user, err, "user.update_failed")
+		return
+	}
+
+	h.respondWithUser(c, user)
+}
+
+// InviteUser godoc
+// @Summary Invite a new user
+// @Description Create a user in the invited status, returning the invitation token they accept to set their password.
+// @Description The token is only returned once, and expires after INVITATION_TTL (72h by default).
+// @Description Requires the admin:users scope, as the token lets its holder sign in as the user.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param user body models.User true "User"
+// @Param Idempotency-Key header string false "Key making retries of the request return the first response"
+// @Security BearerToken
+// @Success 201 {object} Invitation
+// @Failure 400 {object} object "message: Invalid user"
+// @Failure 403 {object} object "message: Insufficient scope"
+// @Router /users/invitations [post]
+func (h *UserHandler) InviteUser(c *gin.Context) {
+	var user models.User
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
+
+	// Decode JSON request body, dropping attributes the client cannot read
+	if errMap := user.DecodeJSONRequest(c, &user); len(errMap) > 0 {
+		errors := user.AdjustFieldErrors(errMap)
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
+		return
+	}
+	user.Metadata = schema.Keep(user.Metadata, nil, hasScope)
+
+	// Validate and create the invited user
+	token, err := h.users.Invite(c.Request.Context(), &user)
+	if err != nil {
+		respondWithUserError(c, &user, err, "user.create_failed")
+		return
+	}
+
+	schema.Hide(user.Metadata, hasScope)
+	api.RespondWithJSON(c, http.StatusCreated, Invitation{User: &user, Token: token, ExpiresAt: *user.InvitationExpiresAt})
+}
+
+// ReissueInvitation godoc
+// @Summary Reissue the invitation of a user
+// @Description Issue a new invitation token for an invited user, invalidating the previous one.
+// @Description Requires the admin:users scope, as the token lets its holder sign in as the user.
+// @Tags users
+// @Produce  json
+// @Param id path int true "User ID"
+// @Param If-Match header string false "ETag of the user"
+// @Security BearerToken
+// @Success 201 {object} Invitation
+// @Failure 400 {object} object "message: Invalid user ID"
+// @Failure 403 {object} object "message: Insufficient scope"
+// @Failure 404 {object} object "message: User not found"
+// @Failure 409 {object} object "message: User is not invited"
+// @Failure 410 {object} object "message: User was deleted"
+// @Failure 412 {object} object "message: Precondition failed"
+// @Router /users/{id}/invitation [post]
+func (h *UserHandler) ReissueInvitation(c *gin.Context) {
+	// Check if user exists, is still invited and the client is updating its current version
+	user, ok := h.lookup(c, false)
+	if !ok {
+		return
+	}
+	if user.Status != models.StatusInvited {
+		api.RespondWithError(c, http.StatusConflict, "user.not_invited")
+		return
+	}
+	if !api.CheckIfMatch(c, user.ETag) {
+		return
+	}
+
+	// Replace the invitation token
+	token, err := h.users.Reinvite(c.Request.Context(), user)
+	if err != nil {
+		respondWithUserError(c, user, err, "user.update_failed")
+		return
+	}
+
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
+	schema.Hide(user.Metadata, hasScope)
+	api.RespondWithJSON(c, http.StatusCreated, Invitation{User: user, Token: token, ExpiresAt: *user.InvitationExpiresAt})
+}
+
+// AcceptInvitation godoc
+// @Summary Accept an invitation
+// @Description Set the password of an invited user with their invitation token, activating the account
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param invitation body AcceptInvitationRequest true "Invitation token and password"
+// @Success 200 {object} models.User
+// @Failure 400 {object} object "message: Invalid or expired invitation"
+// @Router /users/invitations/accept [post]
+func (h *UserHandler) AcceptInvitation(c *gin.Context) {
+	// Validate JSON request body
+	var input AcceptInvitationRequest
+	var base models.Base
+	if errMap := base.ValidateJSONRequestAndFields(c, nil, &input); len(errMap) > 0 {
+		errors := base.AdjustFieldErrors(errMap, "AcceptInvitationRequest")
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
+		return
+	}
+
+	// Set the password of the user invited with the token and activate the user
+	user, err := h.users.AcceptInvitation(c.Request.Context(), input.Token, input.Password)
+	if err == models.ErrInvalidInvitation {
+		api.RespondWithError(c, http.StatusBadRequest, "user.invalid_invitation")
+		return
+	}
+	if err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "user.update_failed")
+		return
+	}
+
+	h.respondWithUser(c, user)
+}
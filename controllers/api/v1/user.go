@@ -1,26 +1,35 @@
 package v1
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"microservice/config"
 	"microservice/controllers/api"
+	"microservice/i18n"
+	"microservice/jobs"
+	"microservice/middlewares"
 	"microservice/models"
+	"microservice/repositories"
+	"microservice/services"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// Define UsersResponse struct
-type UsersResponse struct {
-	Data       []models.User          `json:"data"`
-	Pagination api.PaginationResponse `json:"pagination"`
-}
-
 // OptionsUsers handles OPTIONS requests for the /users endpoint
 func OptionsUsers(c *gin.Context) {
 	c.Header("Allow", "OPTIONS, GET, POST, PUT, PATCH, DELETE")
 	c.Header("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, PATCH, DELETE")
-	c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, Idempotency-Key")
+	c.Header("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed")
+	c.Header("Accept-Patch", api.AcceptPatch)
 	api.RespondWithJSON(c, http.StatusOK, gin.H{})
 }
 
@@ -30,56 +39,209 @@ func HeadUsers(c *gin.Context) {
 	api.RespondWithJSON(c, http.StatusOK, gin.H{})
 }
 
+// UserHandler handles the user endpoints
+type UserHandler struct {
+	users *services.UserService
+	// background runs the imports, which outlive their requests
+	background *jobs.Background
+	// imports tracks the imports started through the handler
+	imports *api.ImportJobs
+}
+
+// NewUserHandler returns the user handlers, managing users with the service
+func NewUserHandler(users *services.UserService, background *jobs.Background) *UserHandler {
+	return &UserHandler{users: users, background: background, imports: api.NewImportJobs()}
+}
+
 // ListUsers godoc
 // @Summary Get all users
 // @Description Get all users with optional filtering and pagination
+// @Description Custom attributes are filtered as metadata.<name>, e.g. metadata.team=blue or metadata.level[gte]=3.
+// @Description Attributes with a read scope are only returned and filterable with a token granting that scope.
 // @Tags users
 // @Accept  json
 // @Produce  json
-// @Param name query string false "Name"
-// @Param age query int false "Age"
+// @Param name query string false "Filter by name, also name[ne], name[like] with * wildcards, name[in]"
+// @Param email query string false "Filter by email, also email[ne], email[like], email[in]"
+// @Param age query int false "Filter by age, also age[gt], age[gte], age[lt], age[lte], age[in], age[between]"
+// @Param created_at query string false "Filter by creation time, also created_at[gte], created_at[between]=from,to"
 // @Param ids query string false "Comma-separated list of user IDs"
+// @Param group query string false "Comma-separated group IDs, matching their members directly or through nested groups"
+// @Param sort query string false "Comma-separated sort fields, prefixed with - for descending order"
 // @Param page query int false "Page number"
 // @Param limit query int false "Number of items per page"
-// @Success 200 {object} UsersResponse
+// @Param pagination query string false "Set to cursor to request the first page in cursor mode"
+// @Param cursor query string false "Opaque cursor of the page to fetch, from the next or previous link"
+// @Param count query bool false "Set to false to skip computing the total count"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Param expand query string false "Comma-separated list of relations to embed"
+// @Param If-None-Match header string false "ETag of a cached representation"
+// @Success 200 {object} api.ListResponse{data=[]models.User}
+// @Header 200 {string} Link "RFC 8288 links to the first, previous, next and last pages"
+// @Header 200 {integer} X-Total-Count "Total number of users matching the filters"
+// @Success 304 "Not Modified"
+// @Failure 400 {object} object "message: Invalid query parameters"
+// @Failure 403 {object} object "message: Insufficient scope to include soft-deleted users"
+// @Param trashed query string false "Include soft-deleted users, requiring the delete:users scope" Enums(with, only)
 // @Router /users [get]
-func ListUsers(c *gin.Context) {
+func (h *UserHandler) ListUsers(c *gin.Context) {
 	var users []models.User
-	page, limit := api.ValidateAndParsePagination(c)
-	query := models.DB
+	db, ok := h.query(c)
+	if !ok {
+		return
+	}
+	query := db
 
-	// Optional filtering
-	if name := c.Query("name"); name != "" {
-		query = query.Where("name = ?", name)
+	// Validate pagination parameters
+	page, limit, errors := api.ValidateAndParsePagination(c)
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_pagination", errors)
+		return
 	}
-	if age, err := strconv.Atoi(c.Query("age")); err == nil {
-		query = query.Where("age = ?", age)
+
+	// Parse filters, including on the custom attributes the client can read, sort order and requested fields
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
+	listQuery, errors := api.ParseListQuery(c, userQueryFields(db, schema, hasScope))
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_query", errors)
+		return
+	}
+	projection, errors := api.ParseProjection(c, &models.User{})
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_query", errors)
+		return
+	}
+	if query, ok = trashed(c, query); !ok {
+		return
 	}
-	if ids := c.Query("ids"); ids != "" {
-		idList := strings.Split(ids, ",")
-		query = query.Where("id IN (?)", idList)
+	query = listQuery.Filter(query)
+	if query, ok = filterByGroup(c, db, query); !ok {
+		return
 	}
+	query = query.Session(&gorm.Session{})
 
-	// Apply limit and offset
-	offset := (page - 1) * limit
-	query = query.Limit(limit).Offset(offset)
+	// Calculate total count on the filtered query, unless the client opted out
+	var total *int
+	if api.WantsTotalCount(c) {
+		var count int64
+		if err := query.Model(&models.User{}).Count(&count).Error; err != nil {
+			api.RespondWithError(c, http.StatusInternalServerError, "user.fetch_failed")
+			return
+		}
+		totalCount := int(count)
+		total = &totalCount
+	}
 
-	// Execute query
-	query.Find(&users)
+	// Select only the requested fields, keeping the sort keys needed for cursors
+	query = projection.Apply(query, listQuery.SortColumns()...)
 
-	// Calculate total count
-	var totalCount int
-	query.Model(&models.User{}).Count(&totalCount)
+	var pagination api.PaginationResponse
+	if api.IsCursorPagination(c) {
+		// Fetch the page following or preceding the cursor
+		next, prev, err := listQuery.FindCursorPage(query, c.Query("cursor"), limit, &users)
+		if err == api.ErrInvalidCursor {
+			api.RespondWithError(c, http.StatusBadRequest, "request.invalid_cursor")
+			return
+		}
+		if err != nil {
+			api.RespondWithError(c, http.StatusInternalServerError, "user.fetch_failed")
+			return
+		}
+		pagination = api.GetCursorPagination(c, limit, next, prev, listQuery.LastCursor(), total)
+	} else {
+		// Apply limit and offset, fetching one extra row to know whether a next page exists
+		offset := (page - 1) * limit
+		if err := listQuery.Order(query).Limit(limit + 1).Offset(offset).Find(&users).Error; err != nil {
+			api.RespondWithError(c, http.StatusInternalServerError, "user.fetch_failed")
+			return
+		}
+		hasNext := len(users) > limit
+		if hasNext {
+			users = users[:limit]
+		}
 
-	// Create pagination metadata
-	nextPage, prevPage := api.GetPaginationLinks(c, page, limit, totalCount)
+		// Create pagination metadata
+		pagination = api.GetPagination(c, page, limit, total, hasNext)
+	}
 
-	// Create response object
-	response := UsersResponse{
-		Data:       users,
-		Pagination: api.PaginationResponse{Next: nextPage, Previous: prevPage, Total: totalCount},
+	// Create response object without the attributes hidden from the client
+	for i := range users {
+		schema.Hide(users[i].Metadata, hasScope)
 	}
+	response := api.ListResponse{
+		Data:       projection.RenderAll(users),
+		Pagination: pagination,
+	}
+
+	api.SetPaginationHeaders(c, pagination)
+	api.RespondWithETag(c, http.StatusOK, api.ETagOf(response), response)
+}
+
+// UserSearchResult is a user matching a search with its relevance and highlighted fragments
+type UserSearchResult struct {
+	models.User
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights"`
+}
 
+// SearchUsers godoc
+// @Summary Search users
+// @Description Full-text search of users by partial name or email, ordered by relevance
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param q query string true "Search terms, each matched as a word prefix"
+// @Param page query int false "Page number"
+// @Param limit query int false "Number of items per page"
+// @Success 200 {object} api.ListResponse{data=[]UserSearchResult}
+// @Failure 400 {object} object "message: Missing search query"
+// @Failure 503 {object} object "message: Search is unavailable"
+// @Router /users/search [get]
+func (h *UserHandler) SearchUsers(c *gin.Context) {
+	// Validate search and pagination parameters
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		api.RespondWithError(c, http.StatusBadRequest, "search.missing_query")
+		return
+	}
+	page, limit, errors := api.ValidateAndParsePagination(c)
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_pagination", errors)
+		return
+	}
+	// Search the users
+	hits, total, err := h.users.Search(c.Request.Context(), q, limit, (page-1)*limit)
+	if err == repositories.ErrSearchUnavailable {
+		api.RespondWithError(c, http.StatusServiceUnavailable, "search.unavailable")
+		return
+	}
+	if err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "user.fetch_failed")
+		return
+	}
+
+	// Keep the relevance order of the hits, hiding attributes from the client
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
+	results := make([]UserSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		schema.Hide(hit.User.Metadata, hasScope)
+		results = append(results, UserSearchResult{User: *hit.User, Rank: hit.Rank, Highlights: hit.Highlights})
+	}
+
+	// Create pagination metadata and response object
+	pagination := api.GetPagination(c, page, limit, &total, false)
+	response := api.ListResponse{
+		Data:       results,
+		Pagination: pagination,
+	}
+
+	api.SetPaginationHeaders(c, pagination)
 	api.RespondWithJSON(c, http.StatusOK, response)
 }
 
@@ -90,28 +252,41 @@ func ListUsers(c *gin.Context) {
 // @Accept  json
 // @Produce  json
 // @Param id path int true "User ID"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Param expand query string false "Comma-separated list of relations to embed"
+// @Param If-None-Match header string false "ETag of a cached representation"
 // @Success 200 {object} models.User
+// @Success 304 "Not Modified"
+// @Failure 400 {object} object "message: Invalid user ID"
+// @Failure 404 {object} object "message: User not found"
+// @Failure 410 {object} object "message: User was deleted"
 // @Router /users/{id} [get]
-func GetUser(c *gin.Context) {
-	// Get user ID from URL parameter
-	userID := c.Param("id")
-
-	// Convert user ID to integer
-	id, err := strconv.Atoi(userID)
-	if err != nil {
-		api.RespondWithError(c, http.StatusBadRequest, "Invalid user ID")
+func (h *UserHandler) GetUser(c *gin.Context) {
+	// Parse requested fields
+	projection, errors := api.ParseProjection(c, &models.User{})
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_query", errors)
 		return
 	}
 
-	// Retrieve user from the database
-	var user models.User
-	if err := models.DB.First(&user, id).Error; err != nil {
-		api.RespondWithError(c, http.StatusNotFound, "User not found")
+	// Retrieve the user
+	user, ok := h.lookup(c, false)
+	if !ok {
 		return
 	}
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
+	schema.Hide(user.Metadata, hasScope)
 
-	// Return the user as JSON response
-	api.RespondWithJSON(c, http.StatusOK, user)
+	// Return the user as JSON response, partial representations having their own ETag
+	if projection.IsEmpty() {
+		api.RespondWithETag(c, http.StatusOK, user.ETag, user)
+		return
+	}
+	rendered := projection.Render(user)
+	api.RespondWithETag(c, http.StatusOK, api.ETagOf(rendered), rendered)
 }
 
 // CreateUser godoc
@@ -121,22 +296,28 @@ func GetUser(c *gin.Context) {
 // @Accept  json
 // @Produce  json
 // @Param user body models.User true "User"
+// @Param Idempotency-Key header string false "Key making retries of the request return the first response"
 // @Security BearerToken
 // @Success 200 {object} models.User
 // @Router /users [post]
-func CreateUser(c *gin.Context) {
+func (h *UserHandler) CreateUser(c *gin.Context) {
 	var user models.User
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
 
-	// Validate JSON request body
-	if errMap := user.ValidateJSONRequestAndFields(c, &user); len(errMap) > 0 {
+	// Decode JSON request body, dropping attributes the client cannot read
+	if errMap := user.DecodeJSONRequest(c, &user); len(errMap) > 0 {
 		errors := user.AdjustFieldErrors(errMap)
-		api.RespondWithError(c, http.StatusBadRequest, "Invalid JSON format", errors)
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
 		return
 	}
+	user.Metadata = schema.Keep(user.Metadata, nil, hasScope)
 
-	// Create user in the database
-	if err := models.DB.Create(&user).Error; err != nil {
-		api.RespondWithError(c, http.StatusInternalServerError, "Failed to create user")
+	// Validate and create the user
+	if err := h.users.Create(c.Request.Context(), &user); err != nil {
+		respondWithUserError(c, &user, err, "user.create_failed")
 		return
 	}
 
@@ -145,61 +326,691 @@ func CreateUser(c *gin.Context) {
 }
 
 // UpdateUser godoc
-// @Summary Update an existing user
-// @Description Update an existing user by id
+// @Summary Replace an existing user
+// @Description Replace an existing user by id. Read-only fields in the body are ignored.
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param id path int true "User ID"
 // @Param user body models.User true "User"
+// @Param If-Match header string false "ETag of the user being replaced"
 // @Security BearerToken
 // @Success 200 {object} models.User
+// @Failure 400 {object} object "message: Invalid user ID"
+// @Failure 404 {object} object "message: User not found"
+// @Failure 410 {object} object "message: User was deleted"
+// @Failure 412 {object} object "message: Precondition failed"
 // @Router /users/{id} [put]
-func UpdateUser(c *gin.Context) {
-	var user models.User
-	id := c.Param("id")
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	// Check if user exists
+	user, ok := h.lookup(c, false)
+	if !ok {
+		return
+	}
+
+	// Check the client is replacing the current version
+	if !api.CheckIfMatch(c, user.ETag) {
+		return
+	}
+
+	// Decode the replacement user
+	var input models.User
+	if errMap := input.DecodeJSONRequest(c, &input); len(errMap) > 0 {
+		errors := input.AdjustFieldErrors(errMap)
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json", errors)
+		return
+	}
 
+	// Keep attributes hidden from the client from the stored user
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
+	input.Metadata = schema.Keep(input.Metadata, user.Metadata, hasScope)
+
+	// Validate and save the updated user, keeping its read-only fields
+	if err := h.users.Replace(c.Request.Context(), user, &input); err != nil {
+		respondWithUserError(c, &input, err, "user.update_failed")
+		return
+	}
+
+	// Return the updated user as JSON response
+	schema.Hide(input.Metadata, hasScope)
+	api.RespondWithETag(c, http.StatusOK, input.ETag, input)
+}
+
+// PatchUser godoc
+// @Summary Partially update an existing user
+// @Description Update an existing user by id with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902)
+// @Tags users
+// @Accept  application/merge-patch+json
+// @Accept  application/json-patch+json
+// @Produce  json
+// @Param id path int true "User ID"
+// @Param patch body object true "Merge patch or array of patch operations"
+// @Param If-Match header string false "ETag of the user being patched"
+// @Security BearerToken
+// @Success 200 {object} models.User
+// @Failure 400 {object} object "message: Invalid patch document"
+// @Failure 404 {object} object "message: User not found"
+// @Failure 409 {object} object "message: Patch test operation failed"
+// @Failure 410 {object} object "message: User was deleted"
+// @Failure 412 {object} object "message: Precondition failed"
+// @Failure 415 {object} object "message: Unsupported media type"
+// @Router /users/{id} [patch]
+func (h *UserHandler) PatchUser(c *gin.Context) {
 	// Check if user exists
-	if err := models.DB.First(&user, id).Error; err != nil {
-		api.RespondWithError(c, http.StatusNotFound, "User not found")
+	user, ok := h.lookup(c, false)
+	if !ok {
 		return
 	}
 
-	// Validate JSON request body
-	if err := user.ValidateJSONRequestAndFields(c, &user); err != nil {
-		api.RespondWithError(c, http.StatusBadRequest, "Invalid JSON format")
+	// Check the client is patching the current version
+	if !api.CheckIfMatch(c, user.ETag) {
 		return
 	}
 
-	// Save updated user to the database
-	if err := models.DB.Save(&user).Error; err != nil {
-		api.RespondWithError(c, http.StatusInternalServerError, "Failed to update user")
+	// Apply the patch to the stored user as seen by the client, keeping hidden attributes
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
+	stored := models.Metadata{}
+	for name, value := range user.Metadata {
+		stored[name] = value
+	}
+	schema.Hide(user.Metadata, hasScope)
+	if err := api.ApplyPatch(c, user, user.ReadOnlyFields()); err != nil {
+		api.RespondWithError(c, err.Code, err.Message, user.AdjustFieldErrors(err.Errors))
+		return
+	}
+	user.Metadata = schema.Keep(user.Metadata, stored, hasScope)
+
+	// Validate and save the patched user
+	if err := h.users.Update(c.Request.Context(), user); err != nil {
+		respondWithUserError(c, user, err, "user.update_failed")
 		return
 	}
 
 	// Return the updated user as JSON response
-	api.RespondWithJSON(c, http.StatusOK, user)
+	schema.Hide(user.Metadata, hasScope)
+	api.RespondWithETag(c, http.StatusOK, user.ETag, user)
 }
 
 // DeleteUser godoc
 // @Summary Delete a user
-// @Description Delete a user by id
+// @Description Soft-delete a user by id, or permanently delete it with hard=true, which requires the purge:users scope
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param id path int true "User ID"
+// @Param hard query bool false "Permanently delete the user, even if already soft-deleted"
+// @Param If-Match header string false "ETag of the user being deleted"
 // @Security BearerToken
 // @Success 204
+// @Failure 400 {object} object "message: Invalid user ID"
+// @Failure 403 {object} object "message: Insufficient scope"
+// @Failure 404 {object} object "message: User not found"
+// @Failure 410 {object} object "message: User was deleted"
+// @Failure 412 {object} object "message: Precondition failed"
 // @Router /users/{id} [delete]
-func DeleteUser(c *gin.Context) {
-	id := c.Param("id")
-	if err := models.DB.Delete(&models.User{}, id).Error; err != nil {
-		api.RespondWithError(c, http.StatusNotFound, "User not found")
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	// Permanent deletion requires its own scope and also applies to soft-deleted users
+	hard, _ := strconv.ParseBool(c.Query("hard"))
+	if hard && !middlewares.HasScope(c, "purge:users") {
+		api.RespondWithError(c, http.StatusForbidden, "auth.insufficient_scope")
+		return
+	}
+
+	// Check if user exists and is not deleted already
+	user, ok := h.lookup(c, hard)
+	if !ok {
+		return
+	}
+
+	// Check the client is deleting the current version
+	if !api.CheckIfMatch(c, user.ETag) {
+		return
+	}
+
+	// Delete the user unless it was modified in the meantime
+	if err := h.users.Delete(c.Request.Context(), user, hard); err != nil {
+		respondWithUserError(c, user, err, "user.delete_failed")
 		return
 	}
 	c.Status(http.StatusNoContent)
 }
 
+// RestoreUser godoc
+// @Summary Restore a deleted user
+// @Description Undelete a soft-deleted user by id, unless another user took its email in the meantime
+// @Tags users
+// @Produce  json
+// @Param id path int true "User ID"
+// @Param If-Match header string false "ETag of the deleted user"
+// @Param Idempotency-Key header string false "Key making retries of the request return the first response"
+// @Security BearerToken
+// @Success 200 {object} models.User
+// @Failure 400 {object} object "message: Invalid user ID"
+// @Failure 404 {object} object "message: User not found"
+// @Failure 409 {object} object "message: User is not deleted"
+// @Failure 412 {object} object "message: Precondition failed"
+// @Router /users/{id}/restore [post]
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	// Check if user exists, including deleted users
+	user, ok := h.lookup(c, true)
+	if !ok {
+		return
+	}
+
+	// Check the client is restoring the current version
+	if !api.CheckIfMatch(c, user.ETag) {
+		return
+	}
+
+	// Restore the user unless it is not deleted, another user took its email or it was
+	// modified in the meantime
+	if err := h.users.Restore(c.Request.Context(), user); err != nil {
+		respondWithUserError(c, user, err, "user.restore_failed")
+		return
+	}
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
+	schema.Hide(user.Metadata, hasScope)
+	api.RespondWithETag(c, http.StatusOK, user.ETag, user)
+}
+
+// batchScopes maps batch operation methods to the scope they require
+var batchScopes = map[string]string{
+	api.BatchCreate: "create:users",
+	api.BatchUpdate: "update:users",
+	api.BatchDelete: "delete:users",
+}
+
+// BatchUsers godoc
+// @Summary Create, update and delete users in bulk
+// @Description Apply a list of operations in order. Each operation requires the scope of the equivalent single request.
+// @Description Updates apply data as a JSON Merge Patch. In atomic mode all operations are rolled back when one fails,
+// @Description otherwise each operation is applied on its own and results report the status of each one.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param batch body api.BatchRequest true "Operations"
+// @Param Idempotency-Key header string false "Key making retries of the request return the first response"
+// @Security BearerToken
+// @Success 200 {object} api.BatchResponse
+// @Success 207 {object} api.BatchResponse "Some operations failed"
+// @Failure 400 {object} api.ErrorResponse
+// @Router /users:batch [post]
+func (h *UserHandler) BatchUsers(c *gin.Context) {
+	request := api.ParseBatchRequest(c)
+	if request == nil {
+		return
+	}
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
+	batch := &userBatch{emails: make(map[string]uint), schema: schema, hasScope: hasScope}
+	results := make([]api.BatchResult, len(request.Operations))
+
+	// Apply each operation on its own, or all of them in a single transaction
+	if !request.Atomic {
+		for i, op := range request.Operations {
+			results[i] = batch.apply(c, h.users, i, op)
+		}
+		api.RespondWithBatch(c, request, results)
+		return
+	}
+	err := h.users.Transaction(c.Request.Context(), func(users *services.UserService) error {
+		for i, op := range request.Operations {
+			results[i] = batch.apply(c, users, i, op)
+			if !results[i].Succeeded() {
+				return errBatchFailed
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errBatchFailed {
+		api.RespondWithError(c, http.StatusInternalServerError, "user.update_failed")
+		return
+	}
+	api.RespondWithBatch(c, request, results)
+}
+
+// errBatchFailed rolls back atomic batches when an operation fails
+var errBatchFailed = errors.New("batch operation failed")
+
+// userBatch applies the operations of a user batch
+type userBatch struct {
+	emails   map[string]uint         // Emails set by earlier operations, with the ID of their user
+	schema   models.AttributeSchema  // Schema of the custom attributes
+	hasScope func(scope string) bool // Check of the scopes granted to the client
+}
+
+// apply applies a single operation, checking the scope it requires
+func (b *userBatch) apply(c *gin.Context, users *services.UserService, index int, op api.BatchOperation) api.BatchResult {
+	result := api.BatchResult{Index: index}
+	fail := func(code int, message string, errors ...map[string][]string) api.BatchResult {
+		result.Status = code
+		result.Error = api.NewErrorResponse(c, message, errors...)
+		return result
+	}
+
+	scope, ok := batchScopes[op.Method]
+	if !ok {
+		return fail(http.StatusBadRequest, "batch.unknown_method", map[string][]string{"method": {op.Method}})
+	}
+	if !middlewares.HasScope(c, scope) {
+		return fail(http.StatusForbidden, "auth.insufficient_scope")
+	}
+
+	user := &models.User{}
+	if op.Method == api.BatchCreate {
+		// Decode the new user
+		if err := json.Unmarshal(op.Data, user); err != nil {
+			return fail(http.StatusBadRequest, "request.invalid_json", map[string][]string{"_json": {err.Error()}})
+		}
+	} else {
+		// Check if user exists and the client expects its current version
+		if op.ID == 0 {
+			return fail(http.StatusBadRequest, "user.invalid_id")
+		}
+		var err error
+		if user, err = users.Get(c.Request.Context(), op.ID, false); err != nil {
+			return fail(api.LookupStatus(err, "user"))
+		}
+		if code, message := api.Precondition(op.ETag, user.ETag, config.FromContext(c).API.RequireIfMatch); code != 0 {
+			return fail(code, message)
+		}
+	}
+
+	switch op.Method {
+	case api.BatchCreate, api.BatchUpdate:
+		// Apply the merge patch to the stored user as seen by the client, keeping hidden attributes
+		stored := models.Metadata{}
+		if op.Method == api.BatchUpdate {
+			for name, value := range user.Metadata {
+				stored[name] = value
+			}
+			b.schema.Hide(user.Metadata, b.hasScope)
+			if err := api.ApplyMergePatch(c, user, op.Data, user.ReadOnlyFields()); err != nil {
+				return fail(err.Code, err.Message, user.AdjustFieldErrors(err.Errors))
+			}
+		}
+		user.Metadata = b.schema.Keep(user.Metadata, stored, b.hasScope)
+
+		// Check the email was not set earlier in the batch, which the validation cannot see
+		// before the batch is committed
+		email := strings.ToLower(user.Email)
+		if other, ok := b.emails[email]; ok && other != user.ID {
+			message := i18n.T(i18n.FromContext(c), "batch.duplicate", user.Email)
+			return fail(http.StatusBadRequest, "request.invalid_json", map[string][]string{"email": {message}})
+		}
+
+		// Validate and save the user
+		var err error
+		if op.Method == api.BatchCreate {
+			err = users.Create(c.Request.Context(), user)
+			result.Status = http.StatusCreated
+		} else {
+			err = users.Update(c.Request.Context(), user)
+			result.Status = http.StatusOK
+		}
+		if err != nil {
+			failure := "user.update_failed"
+			if op.Method == api.BatchCreate {
+				failure = "user.create_failed"
+			}
+			return fail(userErrorStatus(c, user, err, failure))
+		}
+		b.emails[email] = user.ID
+		b.schema.Hide(user.Metadata, b.hasScope)
+		result.Data = user
+	case api.BatchDelete:
+		// Delete the user unless it was modified in the meantime
+		if err := users.Delete(c.Request.Context(), user, false); err != nil {
+			return fail(userErrorStatus(c, user, err, "user.delete_failed"))
+		}
+		result.Status = http.StatusNoContent
+	}
+	return result
+}
+
+// userExportFields are the fields exported when no sparse fieldset is requested
+var userExportFields = []string{"id", "name", "email", "age", "status", "metadata", "created_at", "updated_at"}
+
+// ExportUsers godoc
+// @Summary Export users
+// @Description Stream the users matching the same filters and sort order as the list endpoint as CSV or NDJSON
+// @Tags users
+// @Produce  text/csv
+// @Produce  application/x-ndjson
+// @Param format query string false "Export format" Enums(csv, ndjson) default(csv)
+// @Param sort query string false "Comma-separated sort fields, descending when prefixed with -"
+// @Param fields query string false "Comma-separated fields to export"
+// @Param group query string false "Comma-separated group IDs, matching their members directly or through nested groups"
+// @Param trashed query string false "Include soft-deleted users, requiring the delete:users scope" Enums(with, only)
+// @Security BearerToken
+// @Success 200 {file} file "One user per row or line"
+// @Failure 400 {object} object "message: Invalid query parameters"
+// @Failure 403 {object} object "message: Insufficient scope"
+// @Router /users/export [get]
+func (h *UserHandler) ExportUsers(c *gin.Context) {
+	format, ok := api.ExportFormat(c)
+	if !ok {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_query", map[string][]string{"format": {c.Query("format")}})
+		return
+	}
+
+	// Parse filters, including on the custom attributes the client can read, sort order and exported fields
+	db, ok := h.query(c)
+	if !ok {
+		return
+	}
+	schema, hasScope, ok := h.attributes(c)
+	if !ok {
+		return
+	}
+	listQuery, errors := api.ParseListQuery(c, userQueryFields(db, schema, hasScope))
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_query", errors)
+		return
+	}
+	projection, errors := api.ParseProjection(c, &models.User{})
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_query", errors)
+		return
+	}
+	query, ok := trashed(c, db)
+	if !ok {
+		return
+	}
+	columns := userExportFields
+	if len(projection.Fields) > 0 {
+		columns = projection.Fields
+	}
+	query = listQuery.Filter(query)
+	if query, ok = filterByGroup(c, db, query); !ok {
+		return
+	}
+
+	// Exports can outlast the write timeout of the server, so it does not apply while streaming
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	// Stream the users without loading them all in memory
+	rows, err := listQuery.Order(projection.Apply(query.Model(&models.User{}))).Rows()
+	if err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "user.fetch_failed")
+		return
+	}
+	defer rows.Close()
+
+	writer, err := api.NewRecordWriter(c, format, "users", columns)
+	if err != nil {
+		log.Println("Failed to export users:", err)
+		return
+	}
+	for rows.Next() {
+		var user models.User
+		if err := db.ScanRows(rows, &user); err != nil {
+			log.Println("Failed to export users:", err)
+			return
+		}
+		schema.Hide(user.Metadata, hasScope)
+		if err := writer.Write(user); err != nil {
+			log.Println("Failed to export users:", err)
+			return
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		log.Println("Failed to export users:", err)
+	}
+}
+
+// ImportUsers godoc
+// @Summary Import users
+// @Description Start an asynchronous import of users from a CSV file with a header row or from NDJSON.
+// @Description Each row is validated like a created user and upserted by email. Poll the returned job for row-level errors.
+// @Tags users
+// @Accept  text/csv
+// @Accept  application/x-ndjson
+// @Produce  json
+// @Param format query string false "Import format, defaults to the content type" Enums(csv, ndjson)
+// @Param dry_run query bool false "Validate the rows without saving them"
+// @Param file body string true "Users to import"
+// @Param Idempotency-Key header string false "Key making retries of the request return the first response"
+// @Security BearerToken
+// @Success 202 {object} api.ImportJob
+// @Header 202 {string} Location "URL of the import job"
+// @Failure 400 {object} object "message: Invalid import file"
+// @Failure 413 {object} object "message: Request body is too large"
+// @Failure 415 {object} object "message: Unsupported media type"
+// @Router /users/import [post]
+func (h *UserHandler) ImportUsers(c *gin.Context) {
+	format, ok := api.ImportFormat(c)
+	if !ok {
+		api.RespondWithError(c, http.StatusUnsupportedMediaType, "request.unsupported_media_type")
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+	// Read the whole file before responding, as the request body is closed afterwards
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, api.MaxImportSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			api.RespondWithError(c, http.StatusRequestEntityTooLarge, "request.too_large")
+			return
+		}
+		api.RespondWithError(c, http.StatusBadRequest, "import.invalid_file", map[string][]string{"_file": {err.Error()}})
+		return
+	}
+	rows, err := api.ReadImportRows(data, format, (&models.User{}).QueryFields())
+	if err != nil {
+		api.RespondWithError(c, http.StatusBadRequest, "import.invalid_file", map[string][]string{"_file": {err.Error()}})
+		return
+	}
+
+	// Import the rows in the background
+	job := h.imports.New(format, dryRun, middlewares.Subject(c))
+	copied := c.Copy()
+	h.background.Go(func(ctx context.Context) {
+		h.importUsers(ctx, copied, job, rows)
+	})
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+job.ID)
+	api.RespondWithJSON(c, http.StatusAccepted, job.Snapshot())
+}
+
+// GetImportJob godoc
+// @Summary Get a user import job
+// @Description Get the progress and row-level errors of a user import started by the same client
+// @Tags users
+// @Produce  json
+// @Param id path string true "Import job ID"
+// @Security BearerToken
+// @Success 200 {object} api.ImportJob
+// @Failure 404 {object} object "message: Import job not found"
+// @Router /users/import/{id} [get]
+func (h *UserHandler) GetImportJob(c *gin.Context) {
+	job := h.imports.Find(c.Param("id"), middlewares.Subject(c))
+	if job == nil {
+		api.RespondWithError(c, http.StatusNotFound, "import.not_found")
+		return
+	}
+	api.RespondWithJSON(c, http.StatusOK, job.Snapshot())
+}
+
+// importUsers upserts the imported rows by email, recording the outcome of each row in the job.
+// The import fails when background is canceled.
+func (h *UserHandler) importUsers(background context.Context, c *gin.Context, job *api.ImportJob, rows []api.ImportRow) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("User import failed:", r)
+			job.Finish(true)
+		}
+	}()
+
+	// The import outlives the request, so only the values of its context are kept, and it
+	// stops with the background work
+	ctx, cancel := context.WithCancel(context.WithoutCancel(c.Request.Context()))
+	defer cancel()
+	defer context.AfterFunc(background, cancel)()
+	schema, err := h.users.AttributeSchema(ctx)
+	if err != nil {
+		log.Println("User import failed:", err)
+		job.Finish(true)
+		return
+	}
+	hasScope := func(scope string) bool {
+		return middlewares.HasScope(c, scope)
+	}
+
+	job.Start(len(rows))
+	lines := make(map[string]int) // Line of each imported email
+	locale := i18n.FromContext(c)
+	for _, row := range rows {
+		if ctx.Err() != nil {
+			break
+		}
+		if row.Err != nil {
+			job.Reject(row.Line, map[string][]string{"_row": {row.Err.Error()}})
+			continue
+		}
+
+		// Decode the user
+		var user models.User
+		if err := json.Unmarshal(row.Data, &user); err != nil {
+			job.Reject(row.Line, map[string][]string{"_json": {err.Error()}})
+			continue
+		}
+		email := strings.ToLower(user.Email)
+		if line, ok := lines[email]; ok {
+			job.Reject(row.Line, map[string][]string{"email": {i18n.T(locale, "import.duplicate", user.Email, strconv.Itoa(line))}})
+			continue
+		}
+
+		// Update the user with the same email if any, keeping the attributes hidden from the
+		// client, and save it unless validating only
+		metadata := user.Metadata
+		created, err := h.users.Import(ctx, &user, func(stored models.Metadata) models.Metadata {
+			return schema.Keep(metadata, stored, hasScope)
+		}, job.DryRun)
+		if err != nil && ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			_, message, errors := userErrorStatus(c, &user, err, "user.update_failed")
+			if created && message == "user.update_failed" {
+				message = "user.create_failed"
+			}
+			if len(errors) == 0 {
+				errors = map[string][]string{"_row": {i18n.T(locale, message)}}
+			}
+			job.Reject(row.Line, errors)
+			continue
+		}
+		lines[email] = row.Line
+		job.Record(created)
+	}
+	if ctx.Err() != nil {
+		log.Println("User import canceled at shutdown")
+		job.Finish(true)
+		return
+	}
+	job.Finish(false)
+}
+
+// lookup loads the user identified by the id path parameter, responding with an error unless
+// it is found, like api.Lookup
+func (h *UserHandler) lookup(c *gin.Context, withTrashed bool) (*models.User, bool) {
+	id, ok := api.ParseID(c, "user")
+	if !ok {
+		return nil, false
+	}
+	user, err := h.users.Get(c.Request.Context(), id, withTrashed)
+	if err != nil {
+		code, message := api.LookupStatus(err, "user")
+		api.RespondWithError(c, code, message)
+		return nil, false
+	}
+	return user, true
+}
+
+// query returns the query of the users the list endpoints filter and paginate, responding
+// with an error when the users cannot be queried
+func (h *UserHandler) query(c *gin.Context) (*gorm.DB, bool) {
+	db, err := h.users.Query(c.Request.Context())
+	if err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "user.fetch_failed")
+		return nil, false
+	}
+	return db, true
+}
+
+// trashedScope is the scope of the clients managing deleted users, which alone can list them
+const trashedScope = "delete:users"
+
+// trashed includes the soft-deleted users in the query as requested with the trashed
+// parameter, responding with an error when the value is invalid or the client lacks trashedScope
+func trashed(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	query, errors := api.Trashed(c, query)
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_query", errors)
+		return nil, false
+	}
+	if c.Query("trashed") != "" && !middlewares.HasScope(c, trashedScope) {
+		api.RespondWithError(c, http.StatusForbidden, "auth.insufficient_scope")
+		return nil, false
+	}
+	return query, true
+}
+
+// attributes loads the attribute schema of users and the check of the scopes granted
+// to the client, responding with an error when the schema cannot be loaded
+func (h *UserHandler) attributes(c *gin.Context) (models.AttributeSchema, func(scope string) bool, bool) {
+	schema, err := h.users.AttributeSchema(c.Request.Context())
+	if err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "attribute.fetch_failed")
+		return nil, nil, false
+	}
+	hasScope := func(scope string) bool {
+		return middlewares.HasScope(c, scope)
+	}
+	return schema, hasScope, true
+}
+
+// userErrorStatus returns the status code, error code and field errors of a failed change
+// of a user, failure being the error code of unexpected errors
+func userErrorStatus(c *gin.Context, user *models.User, err error, failure string) (int, string, map[string][]string) {
+	var invalid *services.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		return http.StatusBadRequest, "request.invalid_json", user.AdjustFieldErrors(models.FieldErrors(c, invalid.Err))
+	case err == models.ErrVersionConflict:
+		return http.StatusPreconditionFailed, "request.precondition_failed", nil
+	case err == services.ErrNotDeleted:
+		return http.StatusConflict, "user.not_deleted", nil
+	case err == services.ErrEmailTaken:
+		return http.StatusConflict, "user.email_taken", nil
+	case err == services.ErrNotInvited:
+		return http.StatusConflict, "user.not_invited", nil
+	case err == services.ErrNoAvatar:
+		return http.StatusNotFound, "avatar.not_found", nil
+	default:
+		return http.StatusInternalServerError, failure, nil
+	}
+}
+
+// respondWithUserError responds with the error of a failed change of a user
+func respondWithUserError(c *gin.Context, user *models.User, err error, failure string) {
+	code, message, errors := userErrorStatus(c, user, err, failure)
+	api.RespondWithError(c, code, message, errors)
+}
+
 // DummyListUsers godoc
 // @Summary Test goroutine to fetch users
 // @Description Fetches users concurrently from dummy API with pagination
@@ -212,8 +1023,11 @@ func DeleteUser(c *gin.Context) {
 // @Router /users/dummy [get]
 func DummyListUsers(c *gin.Context) {
 	// Pagination parameters
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	page, limit, errors := api.ValidateAndParsePagination(c)
+	if len(errors) > 0 {
+		api.RespondWithError(c, http.StatusBadRequest, "request.invalid_pagination", errors)
+		return
+	}
 
 	// Prepare options for concurrent requests
 	var options []api.RequestOptions
@@ -227,7 +1041,7 @@ func DummyListUsers(c *gin.Context) {
 	// Perform concurrent requests
 	responses, err := api.PerformConcurrentRequests(options)
 	if err != nil {
-		api.RespondWithError(c, http.StatusInternalServerError, "Failed to fetch users")
+		api.RespondWithError(c, http.StatusInternalServerError, "user.fetch_failed")
 		return
 	}
 
@@ -246,15 +1060,12 @@ func DummyListUsers(c *gin.Context) {
 	totalCount := 100
 
 	// Calculate pagination metadata
-	nextPage, prevPage := api.GetPaginationLinks(c, page, limit, totalCount)
+	pagination := api.GetPagination(c, page, limit, &totalCount, false)
 
 	response := api.DataPaginationResponse{
-		Data: users,
-		Pagination: api.PaginationResponse{
-			Next:     nextPage,
-			Previous: prevPage,
-			Total:    totalCount,
-		},
+		Data:       users,
+		Pagination: pagination,
 	}
+	api.SetPaginationHeaders(c, pagination)
 	api.RespondWithJSON(c, http.StatusOK, response)
 }
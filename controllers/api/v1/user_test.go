@@ -0,0 +1,177 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"microservice/models"
+	"microservice/repositories"
+	"microservice/services"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// TestMain registers the model validations, as the connect step of the CLI does
+func TestMain(m *testing.M) {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := models.RegisterValidations(v); err != nil {
+			panic(err)
+		}
+	}
+	os.Exit(m.Run())
+}
+
+// newTestRouter serves the user handlers, without authentication, from a repository holding
+// an active user and a soft-deleted user
+func newTestRouter(t *testing.T) (router *gin.Engine, active, deleted *models.User) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	repository := repositories.NewMemoryUsers()
+	active = &models.User{Name: "Ann", Email: "ann@example.com"}
+	deleted = &models.User{Name: "Bob", Email: "bob@example.com"}
+	for _, user := range []*models.User{active, deleted} {
+		if err := repository.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repository.Delete(ctx, deleted, false); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewUserHandler(services.NewUserService(repository, nil, time.Hour), nil)
+	router = gin.New()
+	router.POST("/users", handler.CreateUser)
+	router.GET("/users/:id", handler.GetUser)
+	router.PUT("/users/:id", handler.UpdateUser)
+	router.PATCH("/users/:id", handler.PatchUser)
+	router.DELETE("/users/:id", handler.DeleteUser)
+	router.POST("/users/:id/restore", handler.RestoreUser)
+	router.POST("/users/:id/status", handler.ChangeUserStatus)
+	return router, active, deleted
+}
+
+// serve sends the request to the router, returning the status and the error code of the response
+func serve(router *gin.Engine, method, path, contentType, body string) (int, string) {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	var response struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response.Code
+}
+
+// lookupTest is a request for a user that cannot be found
+type lookupTest struct {
+	path   string
+	status int
+	code   string
+}
+
+func TestUserLookupErrors(t *testing.T) {
+	router, _, deleted := newTestRouter(t)
+
+	requests := []struct {
+		method      string
+		suffix      string
+		contentType string
+		body        string
+	}{
+		{http.MethodGet, "", "", ""},
+		{http.MethodPut, "", "application/json", `{"name":"Cy","email":"cy@example.com"}`},
+		{http.MethodPatch, "", "application/merge-patch+json", `{"name":"Cy"}`},
+		{http.MethodDelete, "", "", ""},
+		{http.MethodPost, "/restore", "", ""},
+	}
+	for _, r := range requests {
+		tests := []lookupTest{
+			{"/users/abc", http.StatusBadRequest, "user.invalid_id"},
+			{"/users/0", http.StatusBadRequest, "user.invalid_id"},
+			{"/users/99", http.StatusNotFound, "user.not_found"},
+		}
+		// Restoring applies to soft-deleted users, which the other requests treat as gone
+		if r.suffix == "" {
+			tests = append(tests, lookupTest{userPath(deleted), http.StatusGone, "user.gone"})
+		}
+
+		for _, test := range tests {
+			status, code := serve(router, r.method, test.path+r.suffix, r.contentType, r.body)
+			if status != test.status || code != test.code {
+				t.Errorf("%s %s = %d %q, want %d %q", r.method, test.path+r.suffix, status, code, test.status, test.code)
+			}
+		}
+	}
+}
+
+func TestRestoreUser(t *testing.T) {
+	router, active, deleted := newTestRouter(t)
+
+	if status, code := serve(router, http.MethodPost, userPath(active)+"/restore", "", ""); status != http.StatusConflict || code != "user.not_deleted" {
+		t.Errorf("restoring an active user = %d %q, want 409 user.not_deleted", status, code)
+	}
+	if status, _ := serve(router, http.MethodPost, userPath(deleted)+"/restore", "", ""); status != http.StatusOK {
+		t.Fatalf("restoring a deleted user = %d, want 200", status)
+	}
+	if status, _ := serve(router, http.MethodGet, userPath(deleted), "", ""); status != http.StatusOK {
+		t.Errorf("getting a restored user = %d, want 200", status)
+	}
+}
+
+func TestChangeUserStatus(t *testing.T) {
+	router, active, _ := newTestRouter(t)
+
+	tests := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"status":"suspended"}`, http.StatusBadRequest, "request.invalid_json"},
+		{`{"status":"active"}`, http.StatusConflict, "user.invalid_transition"},
+		{`{"status":"deactivated"}`, http.StatusOK, ""},
+		{`{"status":"suspended","reason":"Spam"}`, http.StatusConflict, "user.invalid_transition"},
+		{`{"status":"active"}`, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		status, code := serve(router, http.MethodPost, userPath(active)+"/status", "application/json", test.body)
+		if status != test.status || code != test.code {
+			t.Errorf("changing the status with %s = %d %q, want %d %q", test.body, status, code, test.status, test.code)
+		}
+	}
+}
+
+func TestEmailsIgnoreCase(t *testing.T) {
+	router, _, _ := newTestRouter(t)
+
+	if status, code := serve(router, http.MethodPost, "/users", "application/json", `{"name":"Cy","email":"ANN@example.com"}`); status != http.StatusBadRequest || code != "request.invalid_json" {
+		t.Errorf("creating a user with the email of another in upper case = %d %q, want 400 request.invalid_json", status, code)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Cy","email":"Cy@Example.com"}`))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	var user models.User
+	json.Unmarshal(recorder.Body.Bytes(), &user)
+	if user.Email != "cy@example.com" {
+		t.Errorf("created user has email %q, want it in lower case", user.Email)
+	}
+}
+
+// userPath returns the path of the user
+func userPath(user *models.User) string {
+	return "/users/" + strconv.FormatUint(uint64(user.ID), 10)
+}
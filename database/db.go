@@ -1,20 +1,172 @@
 package database
 
 import (
-    "microservice/models"
-    "log"
+	"context"
+	"fmt"
+	"log"
+	"microservice/config"
+	"microservice/models"
+	"microservice/search"
+	"strings"
+	"time"
 
-    "github.com/jinzhu/gorm"
-    _ "github.com/jinzhu/gorm/dialects/postgres"
-    _ "github.com/jinzhu/gorm/dialects/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
-func ConnectDatabase() {
-    var err error
-    models.DB, err = gorm.Open("sqlite3", "local.db")
-    if err != nil {
-        log.Fatal("Failed to connect to database!", err)
-    }
+// Delays between attempts to connect at startup, doubling up to the maximum
+const (
+	initialRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 10 * time.Second
+)
+
+// ConnectDatabase opens the configured database and migrates its schema
+func ConnectDatabase(cfg config.Database) *gorm.DB {
+	db, err := Open(cfg)
+	if err != nil {
+		log.Fatal("Failed to connect to database! ", err)
+	}
+
+	// Bring the schema up to date, or refuse to start until it is
+	if cfg.MigrateOnStart {
+		applied, err := MigrateUp(db, 0)
+		if err != nil {
+			log.Fatal("Failed to migrate the database! ", err)
+		}
+		for _, m := range applied {
+			log.Println("Applied migration", m)
+		}
+	} else if pending, err := PendingMigrations(db); err != nil {
+		log.Fatal("Failed to read the applied migrations! ", err)
+	} else if len(pending) > 0 {
+		log.Fatalf("The database has %d pending migrations, apply them with the migrate up command", len(pending))
+	}
+
+	// Index the users for full-text search, leaving it disabled when the backend is unavailable
+	user := &models.User{}
+	backend, err := search.New(db)
+	if err == nil {
+		var table string
+		if table, err = models.TableName(db, user); err == nil {
+			err = backend.Setup(db, table, user.SearchFields())
+		}
+	}
+	if err == nil {
+		err = models.UseSearch(db, backend)
+	}
+	if err != nil {
+		log.Println("Full-text search disabled:", err)
+	}
+	return db
+}
+
+// Open connects to the database named by the URL, or the SQLite file of the path when the
+// URL is empty, retrying with exponential backoff until the connect timeout elapses so the
+// service can start before its database is ready. The connection pool is then configured.
+func Open(cfg config.Database) (*gorm.DB, error) {
+	rawURL := cfg.URL
+	if rawURL == "" {
+		rawURL = cfg.Path
+	}
+	dialect, source, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+	delay := initialRetryDelay
+	for attempt := 1; ; attempt++ {
+		// Opening pings the database, so a database that is not ready yet fails here
+		db, err := gorm.Open(dialector(dialect, source), &gorm.Config{
+			// Log failed queries, a missing record being an expected outcome
+			Logger: logger.New(log.Default(), logger.Config{LogLevel: logger.Error, IgnoreRecordNotFoundError: true}),
+		})
+		if err == nil {
+			err = configurePool(db, dialect, source, cfg)
+		}
+		if err == nil {
+			return db, nil
+		}
+		// Close the pool of the failed attempt, which gorm leaves open when the ping fails
+		if db != nil {
+			if pool, poolErr := db.DB(); poolErr == nil {
+				pool.Close()
+			}
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return nil, fmt.Errorf("connecting to %s after %d attempts: %w", redact(rawURL), attempt, err)
+		}
+		log.Printf("Database %s unavailable (attempt %d), retrying in %s: %v", redact(rawURL), attempt, delay, err)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// dialector returns the gorm driver of the dialect
+func dialector(dialect, source string) gorm.Dialector {
+	switch dialect {
+	case "postgres":
+		return postgres.Open(source)
+	case "mysql":
+		return mysql.Open(source)
+	default:
+		return sqlite.Open(source)
+	}
+}
+
+// configurePool applies the pool settings of the configuration
+func configurePool(db *gorm.DB, dialect, source string, cfg config.Database) error {
+	pool, err := db.DB()
+	if err != nil {
+		return err
+	}
+	pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	pool.SetMaxIdleConns(cfg.MaxIdleConns)
+	pool.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	pool.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	// Every connection to an in-memory SQLite database opens a new empty database
+	if dialect == "sqlite3" && (strings.Contains(source, ":memory:") || strings.Contains(source, "mode=memory")) {
+		pool.SetMaxOpenConns(1)
+		pool.SetConnMaxLifetime(0)
+		pool.SetConnMaxIdleTime(0)
+	}
+	return nil
+}
+
+// dialectName returns the dialect of the database as named by ParseURL and the migration files
+func dialectName(db *gorm.DB) string {
+	if name := db.Dialector.Name(); name != "sqlite" {
+		return name
+	}
+	return "sqlite3"
+}
+
+// Ping checks that the database answers, for health checks
+func Ping(ctx context.Context, db *gorm.DB) error {
+	if db == nil {
+		return fmt.Errorf("database is not connected")
+	}
+	pool, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return pool.PingContext(ctx)
+}
 
-    models.DB.AutoMigrate(&models.User{})
+// Close closes the connections to the database
+func Close(db *gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	pool, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return pool.Close()
 }
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MigrationLockTimeout is how long to wait for another instance to finish migrating
+var MigrationLockTimeout = 5 * time.Minute
+
+// Locking the migrations across instances of the service
+const (
+	// migrationLockID identifies the lock among the advisory locks of the database, and
+	// migrationLockName among the named locks of the MySQL server, prefixed by the database
+	migrationLockID   = 7213340519
+	migrationLockName = "schema_migrations"
+	// Locks held longer than this on SQLite are left by an instance that crashed
+	staleMigrationLock = 15 * time.Minute
+	lockPollInterval   = time.Second
+)
+
+// migrationLock is the lock row of SQLite databases, which have no advisory locks
+type migrationLock struct {
+	ID       uint `gorm:"primaryKey;autoIncrement:false"`
+	LockedAt time.Time
+}
+
+// TableName returns the table of the lock row
+func (migrationLock) TableName() string {
+	return "schema_migrations_lock"
+}
+
+// withMigrationLock runs fn while holding the lock preventing instances of the service from
+// migrating the database at the same time. The lock is an advisory lock on Postgres and
+// MySQL, released when the connection holding it closes, and a lock row on SQLite.
+func withMigrationLock(db *gorm.DB, fn func() error) error {
+	if err := createTable(db, &SchemaMigration{}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), MigrationLockTimeout)
+	defer cancel()
+
+	var release func()
+	var err error
+	switch dialectName(db) {
+	case "postgres":
+		release, err = advisoryLock(ctx, db, "SELECT pg_try_advisory_lock($1)", "SELECT pg_advisory_unlock($1)", migrationLockID)
+	case "mysql":
+		release, err = advisoryLock(ctx, db, "SELECT GET_LOCK(CONCAT(DATABASE(), '.', ?), 0)", "SELECT RELEASE_LOCK(CONCAT(DATABASE(), '.', ?))", migrationLockName)
+	default:
+		release, err = rowLock(ctx, db)
+	}
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return fn()
+}
+
+// advisoryLock takes an advisory lock on a dedicated connection, polling until it is free
+func advisoryLock(ctx context.Context, db *gorm.DB, lock, unlock string, key interface{}) (func(), error) {
+	pool, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = poll(ctx, func() (bool, error) {
+		var acquired sql.NullBool
+		err := conn.QueryRowContext(ctx, lock, key).Scan(&acquired)
+		return acquired.Valid && acquired.Bool, err
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), unlock, key); err != nil {
+			log.Println("Failed to release the migration lock:", err)
+		}
+		conn.Close()
+	}, nil
+}
+
+// rowLock takes the lock by inserting the lock row, taking over locks left by crashed instances
+func rowLock(ctx context.Context, db *gorm.DB) (func(), error) {
+	if err := createTable(db, &migrationLock{}); err != nil {
+		return nil, err
+	}
+	err := poll(ctx, func() (bool, error) {
+		if err := db.Where("locked_at < ?", time.Now().Add(-staleMigrationLock)).Delete(&migrationLock{}).Error; err != nil {
+			return false, err
+		}
+		// Nothing is inserted while another instance holds the row
+		result := db.Exec("INSERT OR IGNORE INTO schema_migrations_lock (id, locked_at) VALUES (1, ?)", time.Now())
+		return result.RowsAffected == 1, result.Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := db.Delete(&migrationLock{ID: 1}).Error; err != nil {
+			log.Println("Failed to release the migration lock:", err)
+		}
+	}, nil
+}
+
+// createTable creates the table of a bookkeeping model unless it exists. Existing tables
+// are left as they are, whatever gorm version created them.
+func createTable(db *gorm.DB, model interface{}) error {
+	if db.Migrator().HasTable(model) {
+		return nil
+	}
+	return db.Migrator().CreateTable(model)
+}
+
+// poll calls try until it acquires the lock, fails or the context is done
+func poll(ctx context.Context, try func() (bool, error)) error {
+	for waited := false; ; waited = true {
+		acquired, err := try()
+		if err != nil {
+			return fmt.Errorf("taking the migration lock: %w", err)
+		}
+		if acquired {
+			return nil
+		}
+		if !waited {
+			log.Println("Waiting for another instance to finish migrating the database")
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("taking the migration lock: another instance held it for over %s", MigrationLockTimeout)
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package database
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MigrationsDir is the directory of the migration files in the source tree
+const MigrationsDir = "database/migrations"
+
+// migrationFiles holds the migrations shipped with the binary
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationFile matches the names of migration files, such as 0002_add_user_locale.up.sql,
+// or 0002_add_user_locale.postgres.up.sql for the statements of a single dialect
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+?)(?:\.(sqlite3|postgres|mysql))?\.(up|down)\.sql$`)
+
+// requiredOption matches the first line of SQLite statements needing a compile option of the
+// driver, such as "-- requires: ENABLE_FTS5"
+var requiredOption = regexp.MustCompile(`^-- requires: (\w+)`)
+
+// Migration is a versioned change of the schema, with the statements applying and reverting
+// it on the dialect of the database
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum identifies the statements applying the migration, to detect migrations modified
+// after being applied
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// String returns the version and name of the migration
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// SchemaMigration records a migration applied to the database
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"not null"`
+	Checksum  string `gorm:"not null"`
+	AppliedAt time.Time
+}
+
+// TableName returns the table of the applied migrations
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migration states reported by MigrationStatus
+const (
+	MigrationApplied  = "applied"
+	MigrationPending  = "pending"
+	MigrationModified = "modified" // Applied, but its statements changed since
+	MigrationMissing  = "missing"  // Applied, but unknown to this version of the service
+)
+
+// MigrationState is a migration with whether it was applied
+type MigrationState struct {
+	Migration
+	State     string
+	AppliedAt *time.Time
+}
+
+// LoadMigrations returns the migrations of the dialect in version order. Statements written
+// for the dialect take precedence over those written for every dialect.
+func LoadMigrations(dialect string) ([]Migration, error) {
+	paths, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	// Statements of each version, keyed by direction, optionally prefixed by the dialect
+	names := map[int]string{}
+	statements := map[int]map[string]string{}
+	for _, path := range paths {
+		match := migrationFile.FindStringSubmatch(filepath.Base(path))
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s: name must look like 0001_description.up.sql", path)
+		}
+		version, _ := strconv.Atoi(match[1])
+		name, fileDialect, direction := match[2], match[3], match[4]
+		if fileDialect != "" && fileDialect != dialect {
+			continue
+		}
+		if other, ok := names[version]; ok && other != name {
+			return nil, fmt.Errorf("migration %04d has two names, %s and %s", version, other, name)
+		}
+
+		data, err := migrationFiles.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if statements[version] == nil {
+			names[version] = name
+			statements[version] = map[string]string{}
+		}
+		if fileDialect != "" {
+			direction = fileDialect + "." + direction
+		}
+		statements[version][direction] = string(data)
+	}
+
+	migrations := make([]Migration, 0, len(statements))
+	for version, files := range statements {
+		m := Migration{Version: version, Name: names[version]}
+		up, ok := files[dialect+".up"]
+		if !ok {
+			if up, ok = files["up"]; !ok {
+				return nil, fmt.Errorf("migration %s has no up statements for %s", m, dialect)
+			}
+		}
+		down, ok := files[dialect+".down"]
+		if !ok {
+			down = files["down"]
+		}
+		m.Up, m.Down = up, down
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp applies the pending migrations up to the target version, or every pending
+// migration when target is 0, and returns the applied migrations. It refuses to run when an
+// applied migration was modified since.
+func MigrateUp(db *gorm.DB, target int) ([]Migration, error) {
+	var applied []Migration
+	err := withMigrationLock(db, func() error {
+		states, err := migrationStates(db)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			if state.State == MigrationModified {
+				return fmt.Errorf("migration %s was modified after being applied", state.Migration)
+			}
+		}
+
+		for _, state := range states {
+			if state.State != MigrationPending || (target > 0 && state.Version > target) {
+				continue
+			}
+			if err := apply(db, state.Migration); err != nil {
+				return err
+			}
+			applied = append(applied, state.Migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the given number of most recently applied migrations and returns them
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := withMigrationLock(db, func() error {
+		states, err := migrationStates(db)
+		if err != nil {
+			return err
+		}
+
+		for i := len(states) - 1; i >= 0 && len(reverted) < steps; i-- {
+			state := states[i]
+			switch state.State {
+			case MigrationPending:
+				continue
+			case MigrationMissing:
+				return fmt.Errorf("migration %s is unknown to this version and cannot be reverted", state.Migration)
+			}
+			if state.Down == "" {
+				return fmt.Errorf("migration %s cannot be reverted", state.Migration)
+			}
+			if err := revert(db, state.Migration); err != nil {
+				return err
+			}
+			reverted = append(reverted, state.Migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus returns every known or applied migration with its state, in version order
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	if err := createTable(db, &SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	return migrationStates(db)
+}
+
+// PendingMigrations returns the migrations that are not applied yet
+func PendingMigrations(db *gorm.DB) ([]Migration, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, state := range states {
+		if state.State == MigrationPending {
+			pending = append(pending, state.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// CreateMigration writes empty up and down files for a new migration in dir, numbered after
+// the latest migration, and returns their paths
+func CreateMigration(dir, name string) ([]string, error) {
+	name = strings.ToLower(strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}), "_"))
+	if name == "" {
+		return nil, fmt.Errorf("migration name must contain letters or digits")
+	}
+
+	// Number the migration after those of the source tree and of the binary
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, _ := fs.Glob(migrationFiles, "migrations/*.sql")
+	for _, entry := range entries {
+		files = append(files, entry.Name())
+	}
+	latest := 0
+	for _, file := range files {
+		if match := migrationFile.FindStringSubmatch(filepath.Base(file)); match != nil {
+			if version, _ := strconv.Atoi(match[1]); version > latest {
+				latest = version
+			}
+		}
+	}
+
+	var paths []string
+	headers := map[string]string{"up": "Statements applying", "down": "Statements reverting"}
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%04d_%s.%s.sql", latest+1, name, direction))
+		header := fmt.Sprintf("-- %s migration %04d_%s\n", headers[direction], latest+1, name)
+		if err := os.WriteFile(path, []byte(header), 0o644); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// migrationStates compares the known migrations with those recorded in the database
+func migrationStates(db *gorm.DB) ([]MigrationState, error) {
+	migrations, err := LoadMigrations(dialectName(db))
+	if err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	if err := db.Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	recorded := map[int]SchemaMigration{}
+	for _, record := range records {
+		recorded[record.Version] = record
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Migration: m, State: MigrationPending}
+		if record, ok := recorded[m.Version]; ok {
+			appliedAt := record.AppliedAt
+			state.AppliedAt = &appliedAt
+			state.State = MigrationApplied
+			if record.Checksum != m.Checksum() {
+				state.State = MigrationModified
+			}
+			delete(recorded, m.Version)
+		}
+		states = append(states, state)
+	}
+	for _, record := range recorded {
+		appliedAt := record.AppliedAt
+		states = append(states, MigrationState{
+			Migration: Migration{Version: record.Version, Name: record.Name},
+			State:     MigrationMissing,
+			AppliedAt: &appliedAt,
+		})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// apply runs the up statements of the migration and records it, in a transaction on
+// databases with transactional DDL. MySQL commits each DDL statement on its own. SQLite
+// statements requiring a compile option the driver is built without are skipped, the migration
+// being recorded all the same so that the later migrations apply.
+func apply(db *gorm.DB, m Migration) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if option := unsupportedOption(tx, m.Up); option != "" {
+			log.Printf("Skipped the statements of migration %s, SQLite is built without %s", m, option)
+		} else if err := tx.Exec(m.Up).Error; err != nil {
+			return err
+		}
+		return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, Checksum: m.Checksum(), AppliedAt: time.Now().UTC()}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("applying migration %s: %w", m, err)
+	}
+	return nil
+}
+
+// unsupportedOption returns the compile option required by the statements that the SQLite
+// driver is built without, or an empty string when the statements can run
+func unsupportedOption(db *gorm.DB, statements string) string {
+	match := requiredOption.FindStringSubmatch(statements)
+	if match == nil || dialectName(db) != "sqlite3" {
+		return ""
+	}
+	var used bool
+	if err := db.Raw("SELECT sqlite_compileoption_used(?)", match[1]).Scan(&used).Error; err != nil || used {
+		return ""
+	}
+	return match[1]
+}
+
+// revert runs the down statements of the migration and removes its record
+func revert(db *gorm.DB, m Migration) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(m.Down).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&SchemaMigration{Version: m.Version}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("reverting migration %s: %w", m, err)
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+DROP TABLE idempotency_keys;
+DROP TABLE group_memberships;
+DROP TABLE "groups";
+DROP TABLE attributes;
+DROP TABLE users;
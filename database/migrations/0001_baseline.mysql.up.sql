@@ -0,0 +1,74 @@
+-- Schema created by AutoMigrate before versioned migrations. MySQL has no partial indexes,
+-- so emails and names are only unique among active records through model validation.
+CREATE TABLE IF NOT EXISTS users (
+	id int unsigned AUTO_INCREMENT PRIMARY KEY,
+	created_at DATETIME NULL,
+	updated_at DATETIME NULL,
+	deleted_at DATETIME NULL,
+	version int unsigned NOT NULL DEFAULT 1,
+	status varchar(255) NOT NULL DEFAULT 'active',
+	suspended_reason varchar(255),
+	suspended_until DATETIME NULL,
+	password_hash varchar(255),
+	invitation_hash varchar(255),
+	invitation_expires_at DATETIME NULL,
+	name varchar(255) NOT NULL,
+	email varchar(255) NOT NULL,
+	age int,
+	metadata text NOT NULL DEFAULT ('{}'),
+	avatar varchar(255),
+	INDEX idx_users_deleted_at (deleted_at),
+	INDEX idx_users_status (status),
+	INDEX idx_users_invitation_hash (invitation_hash),
+	INDEX idx_users_email (email)
+);
+
+CREATE TABLE IF NOT EXISTS attributes (
+	id int unsigned AUTO_INCREMENT PRIMARY KEY,
+	created_at DATETIME NULL,
+	updated_at DATETIME NULL,
+	deleted_at DATETIME NULL,
+	version int unsigned NOT NULL DEFAULT 1,
+	name varchar(255) NOT NULL,
+	type varchar(255) NOT NULL,
+	required boolean,
+	validation varchar(255),
+	read_scope varchar(255),
+	description varchar(255),
+	INDEX idx_attributes_deleted_at (deleted_at),
+	INDEX idx_attributes_name (name)
+);
+
+CREATE TABLE IF NOT EXISTS `groups` (
+	id int unsigned AUTO_INCREMENT PRIMARY KEY,
+	created_at DATETIME NULL,
+	updated_at DATETIME NULL,
+	deleted_at DATETIME NULL,
+	version int unsigned NOT NULL DEFAULT 1,
+	name varchar(255) NOT NULL,
+	description varchar(255),
+	INDEX idx_groups_deleted_at (deleted_at),
+	INDEX idx_groups_name (name)
+);
+
+CREATE TABLE IF NOT EXISTS group_memberships (
+	group_id int unsigned,
+	member_type varchar(255),
+	member_id int unsigned,
+	created_at DATETIME NULL,
+	PRIMARY KEY (group_id, member_type, member_id),
+	INDEX idx_group_memberships_member_id (member_id)
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	`key` varchar(255),
+	fingerprint varchar(255) NOT NULL,
+	token varchar(255) NOT NULL,
+	status int,
+	headers text,
+	body longblob,
+	created_at DATETIME NULL,
+	expires_at DATETIME NULL,
+	PRIMARY KEY (`key`),
+	INDEX idx_idempotency_keys_expires_at (expires_at)
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS users_fts;
+DROP TABLE idempotency_keys;
+DROP TABLE group_memberships;
+DROP TABLE "groups";
+DROP TABLE attributes;
+DROP TABLE users;
@@ -0,0 +1,74 @@
+-- Schema created by AutoMigrate before versioned migrations. Existing databases are adopted
+-- as they are, so run the previous release once to bring them up to date before upgrading.
+CREATE TABLE IF NOT EXISTS "users" (
+	"id" integer PRIMARY KEY AUTOINCREMENT,
+	"created_at" datetime,
+	"updated_at" datetime,
+	"deleted_at" datetime,
+	"version" integer NOT NULL DEFAULT 1,
+	"status" varchar(255) NOT NULL DEFAULT 'active',
+	"suspended_reason" varchar(255),
+	"suspended_until" datetime,
+	"password_hash" varchar(255),
+	"invitation_hash" varchar(255),
+	"invitation_expires_at" datetime,
+	"name" varchar(255) NOT NULL,
+	"email" varchar(255) NOT NULL,
+	"age" integer,
+	"metadata" text NOT NULL DEFAULT '{}',
+	"avatar" varchar(255)
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON "users" (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_users_status ON "users" ("status");
+CREATE INDEX IF NOT EXISTS idx_users_invitation_hash ON "users" (invitation_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_active ON "users" (email) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS "attributes" (
+	"id" integer PRIMARY KEY AUTOINCREMENT,
+	"created_at" datetime,
+	"updated_at" datetime,
+	"deleted_at" datetime,
+	"version" integer NOT NULL DEFAULT 1,
+	"name" varchar(255) NOT NULL,
+	"type" varchar(255) NOT NULL,
+	"required" bool,
+	"validation" varchar(255),
+	"read_scope" varchar(255),
+	"description" varchar(255)
+);
+CREATE INDEX IF NOT EXISTS idx_attributes_deleted_at ON "attributes" (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attributes_name_active ON "attributes" (name) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS "groups" (
+	"id" integer PRIMARY KEY AUTOINCREMENT,
+	"created_at" datetime,
+	"updated_at" datetime,
+	"deleted_at" datetime,
+	"version" integer NOT NULL DEFAULT 1,
+	"name" varchar(255) NOT NULL,
+	"description" varchar(255)
+);
+CREATE INDEX IF NOT EXISTS idx_groups_deleted_at ON "groups" (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_groups_name_active ON "groups" (name) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS "group_memberships" (
+	"group_id" integer,
+	"member_type" varchar(255),
+	"member_id" integer,
+	"created_at" datetime,
+	PRIMARY KEY ("group_id", "member_type", "member_id")
+);
+CREATE INDEX IF NOT EXISTS idx_group_memberships_member_id ON "group_memberships" (member_id);
+
+CREATE TABLE IF NOT EXISTS "idempotency_keys" (
+	"key" varchar(255),
+	"fingerprint" varchar(255) NOT NULL,
+	"token" varchar(255) NOT NULL,
+	"status" integer,
+	"headers" text,
+	"body" blob,
+	"created_at" datetime,
+	"expires_at" datetime,
+	PRIMARY KEY ("key")
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON "idempotency_keys" (expires_at);
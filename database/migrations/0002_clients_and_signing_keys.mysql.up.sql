@@ -0,0 +1,20 @@
+CREATE TABLE clients (
+	id int unsigned AUTO_INCREMENT PRIMARY KEY,
+	created_at DATETIME NULL,
+	updated_at DATETIME NULL,
+	deleted_at DATETIME NULL,
+	version int unsigned NOT NULL DEFAULT 1,
+	name varchar(255) NOT NULL,
+	client_id varchar(255) NOT NULL,
+	secret_hash varchar(255) NOT NULL,
+	scope text,
+	INDEX idx_clients_deleted_at (deleted_at),
+	UNIQUE INDEX idx_clients_client_id (client_id)
+);
+
+CREATE TABLE signing_keys (
+	id varchar(255) PRIMARY KEY,
+	secret varchar(255) NOT NULL,
+	created_at DATETIME NULL,
+	retired_at DATETIME NULL
+);
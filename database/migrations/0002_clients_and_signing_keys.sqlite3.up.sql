@@ -0,0 +1,20 @@
+CREATE TABLE "clients" (
+	"id" integer PRIMARY KEY AUTOINCREMENT,
+	"created_at" datetime,
+	"updated_at" datetime,
+	"deleted_at" datetime,
+	"version" integer NOT NULL DEFAULT 1,
+	"name" varchar(255) NOT NULL,
+	"client_id" varchar(255) NOT NULL,
+	"secret_hash" varchar(255) NOT NULL,
+	"scope" text
+);
+CREATE INDEX idx_clients_deleted_at ON "clients" (deleted_at);
+CREATE UNIQUE INDEX idx_clients_client_id ON "clients" (client_id);
+
+CREATE TABLE "signing_keys" (
+	"id" varchar(255) PRIMARY KEY,
+	"secret" varchar(255) NOT NULL,
+	"created_at" datetime,
+	"retired_at" datetime
+);
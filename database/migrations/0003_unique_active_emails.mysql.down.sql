@@ -0,0 +1,3 @@
+ALTER TABLE users
+	DROP INDEX idx_users_email_active,
+	DROP COLUMN active_email;
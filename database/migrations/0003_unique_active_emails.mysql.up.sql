@@ -0,0 +1,5 @@
+-- MySQL has no partial indexes, so the email of active users is copied to a generated column
+-- whose NULL values, those of soft-deleted users, never collide in a unique index
+ALTER TABLE users
+	ADD COLUMN active_email varchar(255) GENERATED ALWAYS AS (IF(deleted_at IS NULL, email, NULL)) VIRTUAL,
+	ADD UNIQUE INDEX idx_users_email_active (active_email);
@@ -0,0 +1 @@
+-- SQLite and Postgres enforce unique emails among active users with the partial index of the baseline
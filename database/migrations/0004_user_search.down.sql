@@ -0,0 +1 @@
+-- Full-text search is only supported on Postgres and SQLite
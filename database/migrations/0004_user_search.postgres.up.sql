@@ -0,0 +1,4 @@
+-- Weighted tsvector of the name and email of users, filled by the search backend.
+-- Databases set up before versioned migrations already have them.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector;
+CREATE INDEX IF NOT EXISTS users_search_vector_idx ON users USING GIN (search_vector);
@@ -0,0 +1,6 @@
+-- requires: ENABLE_FTS5
+-- FTS5 index of the name and email of users, filled by the search backend. The driver is built
+-- with FTS5 by the sqlite_fts5 tag, search staying disabled without it: revert and apply this
+-- migration again after rebuilding with the tag. Databases set up before versioned migrations
+-- already have the table.
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(name, email, tokenize = 'unicode61');
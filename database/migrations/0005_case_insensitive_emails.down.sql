@@ -0,0 +1,3 @@
+-- Emails stay in lower case
+DROP INDEX IF EXISTS idx_users_email_active;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_active ON users (email) WHERE deleted_at IS NULL;
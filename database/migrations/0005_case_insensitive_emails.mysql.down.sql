@@ -0,0 +1,7 @@
+-- Emails stay in lower case
+ALTER TABLE users
+	DROP INDEX idx_users_email_active,
+	DROP COLUMN active_email;
+ALTER TABLE users
+	ADD COLUMN active_email varchar(255) GENERATED ALWAYS AS (IF(deleted_at IS NULL, email, NULL)) VIRTUAL,
+	ADD UNIQUE INDEX idx_users_email_active (active_email);
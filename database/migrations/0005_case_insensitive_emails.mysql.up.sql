@@ -0,0 +1,10 @@
+-- Emails are stored in lower case and compared case-insensitively, so the generated column of
+-- active emails is rebuilt on LOWER(email) whatever the collation of the column. Active users
+-- whose emails differ only in case must be merged first.
+UPDATE users SET email = LOWER(email);
+ALTER TABLE users
+	DROP INDEX idx_users_email_active,
+	DROP COLUMN active_email;
+ALTER TABLE users
+	ADD COLUMN active_email varchar(255) GENERATED ALWAYS AS (IF(deleted_at IS NULL, LOWER(email), NULL)) VIRTUAL,
+	ADD UNIQUE INDEX idx_users_email_active (active_email);
@@ -0,0 +1,6 @@
+-- Emails are stored in lower case and compared case-insensitively, so the index of active
+-- emails is rebuilt on LOWER(email) to also reject emails differing in case written by other
+-- clients of the database. Active users whose emails differ only in case must be merged first.
+UPDATE users SET email = LOWER(email) WHERE email <> LOWER(email);
+DROP INDEX IF EXISTS idx_users_email_active;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_active ON users (LOWER(email)) WHERE deleted_at IS NULL;
@@ -0,0 +1,154 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is used when no requested locale is supported
+const DefaultLocale = "en"
+
+// ContextKey is the Gin context key holding the negotiated locale
+const ContextKey = "locale"
+
+//go:embed locales/*.json
+var builtin embed.FS
+
+var (
+	mu       sync.RWMutex
+	catalogs = map[string]map[string]string{}
+	matcher  language.Matcher
+	tags     []language.Tag
+)
+
+func init() {
+	entries, err := builtin.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := builtin.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		if err := load(strings.TrimSuffix(entry.Name(), ".json"), data); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// LoadDir loads every <locale>.json catalog found in dir, merging it over the built-in messages
+func LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := load(strings.TrimSuffix(filepath.Base(file), ".json"), data); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// load parses a catalog and merges it into the given locale
+func load(locale string, data []byte) error {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return err
+	}
+	messages := make(map[string]string)
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	locale = tag.String()
+	if _, exists := catalogs[locale]; !exists {
+		catalogs[locale] = make(map[string]string)
+		// Keep the default locale first so the matcher falls back to it
+		if locale == DefaultLocale {
+			tags = append([]language.Tag{tag}, tags...)
+		} else {
+			tags = append(tags, tag)
+		}
+		matcher = language.NewMatcher(tags)
+	}
+	for key, msg := range messages {
+		catalogs[locale][key] = msg
+	}
+	return nil
+}
+
+// Supported returns the list of loaded locales
+func Supported() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	locales := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		locales = append(locales, tag.String())
+	}
+	return locales
+}
+
+// Negotiate picks the best supported locale for the given Accept-Language header value
+func Negotiate(acceptLanguage string) string {
+	requested, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(requested) == 0 {
+		return DefaultLocale
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	_, index, confidence := matcher.Match(requested...)
+	if confidence == language.No {
+		return DefaultLocale
+	}
+	return tags[index].String()
+}
+
+// Lookup returns the message for key in the given locale and whether it exists
+func Lookup(locale, key string) (string, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if msg, ok := catalogs[locale][key]; ok {
+		return msg, true
+	}
+	msg, ok := catalogs[DefaultLocale][key]
+	return msg, ok
+}
+
+// T translates key into the given locale, replacing {0}, {1}, ... with params.
+// Unknown keys are returned unchanged.
+func T(locale, key string, params ...string) string {
+	msg, ok := Lookup(locale, key)
+	if !ok {
+		msg = key
+	}
+	for i, param := range params {
+		msg = strings.ReplaceAll(msg, fmt.Sprintf("{%d}", i), param)
+	}
+	return msg
+}
+
+// FromContext returns the locale negotiated for the current request
+func FromContext(c *gin.Context) string {
+	if locale := c.GetString(ContextKey); locale != "" {
+		return locale
+	}
+	return DefaultLocale
+}
@@ -0,0 +1,54 @@
+package i18n
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/id"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	id_translations "github.com/go-playground/validator/v10/translations/id"
+)
+
+var universal = ut.New(en.New(), en.New(), id.New())
+
+// RegisterValidator registers the built-in validation translations and reports field names by their JSON tag
+func RegisterValidator(v *validator.Validate) error {
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	enTrans, _ := universal.GetTranslator("en")
+	if err := en_translations.RegisterDefaultTranslations(v, enTrans); err != nil {
+		return err
+	}
+	idTrans, _ := universal.GetTranslator("id")
+	return id_translations.RegisterDefaultTranslations(v, idTrans)
+}
+
+// TranslateFieldError translates a validation error into the given locale.
+// A "validation.<tag>" catalog entry takes precedence over the universal translator,
+// which lets locales loaded from files translate validation errors as well.
+func TranslateFieldError(locale string, fe validator.FieldError) string {
+	mu.RLock()
+	_, ok := catalogs[locale]["validation."+fe.Tag()]
+	mu.RUnlock()
+	if ok {
+		return T(locale, "validation."+fe.Tag(), fe.Field(), fe.Param())
+	}
+
+	trans, found := universal.GetTranslator(locale)
+	if !found {
+		trans = universal.GetFallback()
+	}
+	return fe.Translate(trans)
+}
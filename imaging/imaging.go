@@ -0,0 +1,159 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// MaxDimension is the maximum width or height of decoded images, so that small
+// files cannot expand into huge bitmaps. The cropped square of the largest image
+// takes 64 MiB while its thumbnails are made.
+const MaxDimension = 4096
+
+// ThumbnailSizes maps thumbnail names to their width and height in pixels
+var ThumbnailSizes = map[string]int{
+	"small":  64,
+	"medium": 256,
+	"large":  512,
+}
+
+// DefaultThumbnail is the thumbnail served when no size is requested
+const DefaultThumbnail = "medium"
+
+// Errors returned when decoding images
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image dimensions are too large")
+)
+
+// decoders maps the sniffed content types to their decoder
+var decoders = map[string]func([]byte) (image.Image, error){
+	"image/jpeg": func(data []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(data)) },
+	"image/png":  func(data []byte) (image.Image, error) { return png.Decode(bytes.NewReader(data)) },
+	"image/gif":  func(data []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(data)) },
+}
+
+// Sniff returns the content type of data from its leading bytes, ignoring any declared type,
+// and reports whether images of that type can be decoded
+func Sniff(data []byte) (string, bool) {
+	contentType := http.DetectContentType(data)
+	_, ok := decoders[contentType]
+	return contentType, ok
+}
+
+// Decode decodes a JPEG, PNG or GIF image, checking its dimensions before decoding the pixels
+func Decode(data []byte) (image.Image, error) {
+	contentType, ok := Sniff(data)
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return nil, ErrTooLarge
+	}
+	return decoders[contentType](data)
+}
+
+// Thumbnails crops the center square of img and scales it to each of the sizes, keyed like
+// sizes. The square is only scaled to the largest size, the smaller thumbnails being derived
+// from that thumbnail, so that the pixels of img are only read once.
+func Thumbnails(img image.Image, sizes map[string]int) map[string]*image.NRGBA {
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+	square := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), img, origin, draw.Src)
+
+	largest := 0
+	for _, size := range sizes {
+		if size > largest {
+			largest = size
+		}
+	}
+	source := scale(square, largest)
+	thumbnails := make(map[string]*image.NRGBA, len(sizes))
+	for name, size := range sizes {
+		thumbnails[name] = source
+		if size != largest {
+			thumbnails[name] = scale(source, size)
+		}
+	}
+	return thumbnails
+}
+
+// scale scales the square to size by size pixels, averaging the source pixels covered by
+// each thumbnail pixel
+func scale(square *image.NRGBA, size int) *image.NRGBA {
+	side := square.Bounds().Dx()
+	thumbnail := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := span(y, size, side)
+		for x := 0; x < size; x++ {
+			x0, x1 := span(x, size, side)
+
+			// Average the covered pixels, weighting colors by their opacity
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := square.Pix[sy*square.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					alpha := uint64(p[3])
+					r += uint64(p[0]) * alpha
+					g += uint64(p[1]) * alpha
+					b += uint64(p[2]) * alpha
+					a += alpha
+					n++
+				}
+			}
+			p := thumbnail.Pix[y*thumbnail.Stride+x*4:]
+			if a > 0 {
+				p[0], p[1], p[2] = uint8(r/a), uint8(g/a), uint8(b/a)
+			}
+			p[3] = uint8(a / n)
+		}
+	}
+	return thumbnail
+}
+
+// span returns the range of source pixels covered by the i-th of size pixels
+func span(i, size, side int) (int, int) {
+	start := i * side / size
+	end := (i + 1) * side / size
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// Format returns the content type thumbnails of img are encoded as: JPEG, or PNG
+// when it may have transparent pixels
+func Format(img image.Image) string {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// Encode encodes img as JPEG or PNG according to contentType
+func Encode(img *image.NRGBA, contentType string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buffer, img)
+	}
+	return buffer.Bytes(), err
+}
@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+)
+
+// Background runs work outliving the requests that start it, such as imports and the purge
+// jobs, so that shutdown can stop the work and wait for it before closing the database
+type Background struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewBackground returns a runner of background work
+func NewBackground() *Background {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Background{ctx: ctx, cancel: cancel}
+}
+
+// Go runs fn in a goroutine, ctx being canceled when the background work is stopped
+func (b *Background) Go(fn func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn(b.ctx)
+	}()
+}
+
+// Stop cancels the background work and waits for it to return
+func (b *Background) Stop() {
+	b.cancel()
+	b.wg.Wait()
+}
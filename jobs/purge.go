@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"microservice/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PurgeTrash permanently deletes users of db soft-deleted for longer than retention, every
+// interval until ctx is canceled
+func PurgeTrash(ctx context.Context, db *gorm.DB, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := models.PurgeTrashed(db.WithContext(ctx), &models.User{}, time.Now().Add(-retention))
+		if err != nil && ctx.Err() == nil {
+			log.Println("Failed to purge deleted users:", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted users", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeIdempotencyKeys deletes the expired idempotency keys of db every interval until ctx is canceled
+func PurgeIdempotencyKeys(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := models.PurgeExpiredIdempotencyKeys(db.WithContext(ctx), time.Now()); err != nil && ctx.Err() == nil {
+			log.Println("Failed to purge expired idempotency keys:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
-	"microservice/database"
+	"microservice/cli"
+	"microservice/config"
 	_ "microservice/docs"
-	"microservice/routes"
-
-	"github.com/joho/godotenv"
+	"os"
 )
 
 // @title Passport Auth API
@@ -29,18 +30,18 @@ import (
 // @scopes.read Access to read endpoints
 // @scopes.write Access to write endpoints
 func main() {
-	// Load environment variables
-	err := godotenv.Load()
+	// Load the configuration from the defaults, the configuration file, the environment and the flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if err == flag.ErrHelp {
+		fmt.Fprintln(os.Stderr, cli.Usage)
+		return
+	}
 	if err != nil {
-		log.Fatalf("Error loading .env file")
+		log.Fatal(err)
 	}
 
-	// Connect to the database
-	database.ConnectDatabase()
-
-	// Setup the router
-	router := routes.SetupRouter()
-
-	// Run the server
-	router.Run(":8080")
+	// Run the command, the server by default
+	if err := cli.Run(cfg, args); err != nil {
+		log.Fatal(err)
+	}
 }
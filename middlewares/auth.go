@@ -1,53 +1,70 @@
 package middlewares
 
 import (
+	"context"
+	"errors"
 	"log"
+	"microservice/config"
+	"microservice/controllers/api"
+	"microservice/models"
+	"microservice/tokens"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware"
 	"github.com/form3tech-oss/jwt-go"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-var jwtMiddleware *jwtmiddleware.JWTMiddleware
-
-func init() {
-	jwtMiddleware = jwtmiddleware.New(jwtmiddleware.Options{
+// newJWTMiddleware returns the validator of tokens issued for the configured audience and issuer,
+// loading signing keys from db with ctx
+func newJWTMiddleware(ctx context.Context, auth config.Auth, db *gorm.DB) *jwtmiddleware.JWTMiddleware {
+	return jwtmiddleware.New(jwtmiddleware.Options{
 		ValidationKeyGetter: func(token *jwt.Token) (interface{}, error) {
-			aud := os.Getenv("AUTH0_AUDIENCE")
-			if !token.Claims.(jwt.MapClaims).VerifyAudience(aud, false) {
+			if !token.Claims.(jwt.MapClaims).VerifyAudience(auth.Audience, false) {
 				return nil, jwt.NewValidationError("invalid audience", jwt.ValidationErrorAudience)
 			}
-			iss := os.Getenv("AUTH0_DOMAIN")
-			if !token.Claims.(jwt.MapClaims).VerifyIssuer(iss, false) {
+			if !token.Claims.(jwt.MapClaims).VerifyIssuer(auth.Domain, false) {
 				return nil, jwt.NewValidationError("invalid issuer", jwt.ValidationErrorIssuer)
 			}
 			if !token.Claims.(jwt.MapClaims).VerifyExpiresAt(time.Now().Unix(), false) {
 				return nil, jwt.NewValidationError("token expired", jwt.ValidationErrorExpired)
 			}
 
-			secret := []byte(os.Getenv("AUTH0_SECRET"))
-			return secret, nil
+			keys := db
+			if keys != nil {
+				keys = keys.WithContext(ctx)
+			}
+			return tokens.VerificationKey(keys, auth, token)
 		},
 		SigningMethod: jwt.SigningMethodHS256,
 	})
 }
 
-func JWTMiddleware() gin.HandlerFunc {
+// JWTMiddleware authenticates requests with a bearer token signed with a signing key of db or the
+// configured secret
+func JWTMiddleware(auth config.Auth, db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		err := jwtMiddleware.CheckJWT(c.Writer, c.Request)
+		err := newJWTMiddleware(c.Request.Context(), auth, db).CheckJWT(c.Writer, c.Request)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized", "details": err.Error()})
+			api.RespondWithError(c, http.StatusUnauthorized, "auth.unauthorized", map[string][]string{"token": {err.Error()}})
 			c.Abort()
 			return
 		}
 		// Extract the token from the request context
 		token, _ := c.Request.Context().Value("user").(*jwt.Token)
 		if token == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+			api.RespondWithError(c, http.StatusUnauthorized, "auth.unauthorized")
+			c.Abort()
+			return
+		}
+
+		// Reject tokens of users who are no longer allowed to sign in
+		if message := checkAccount(c.Request.Context(), db, token); message != "" {
+			api.RespondWithError(c, http.StatusUnauthorized, message)
 			c.Abort()
 			return
 		}
@@ -58,31 +75,54 @@ func JWTMiddleware() gin.HandlerFunc {
 	}
 }
 
-// CheckScope is a middleware to check if the JWT token has the required scope.
-func CheckScope(scope string) gin.HandlerFunc {
+// checkAccount returns the error code for tokens issued to users who are suspended,
+// deactivated or deleted since, or an empty string when the token may be used.
+// Tokens not issued to a user, such as the dummy user's, are not checked.
+func checkAccount(ctx context.Context, db *gorm.DB, token *jwt.Token) string {
+	subject, _ := token.Claims.(jwt.MapClaims)["sub"].(string)
+	id, err := strconv.ParseUint(subject, 10, 0)
+	if err != nil || db == nil {
+		return ""
+	}
+	var user models.User
+	if err := db.WithContext(ctx).Select("id, status, suspended_until").First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "auth.account_deleted"
+		}
+		log.Println("Failed to check account:", err)
+		return "auth.unauthorized"
+	}
+	if !user.CanSignIn() {
+		return "auth.account_" + user.Status
+	}
+	return ""
+}
+
+// OptionalJWTMiddleware authenticates requests sending an Authorization header like
+// JWTMiddleware, and lets anonymous requests through
+func OptionalJWTMiddleware(auth config.Auth, db *gorm.DB) gin.HandlerFunc {
+	authenticate := JWTMiddleware(auth, db)
 	return func(c *gin.Context) {
-		// Get the JWT token from the context
-		token, exists := c.Get("user")
-		log.Println("token: ", token)
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
-			c.Abort()
+		// Responses depend on the scopes of the client
+		c.Writer.Header().Add("Vary", "Authorization")
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
 			return
 		}
+		authenticate(c)
+	}
+}
 
-		// Assert the token to the correct type
-		jwtToken, ok := token.(*jwt.Token)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+// CheckScope is a middleware to check if the JWT token has the required scope.
+func CheckScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("user"); !exists {
+			api.RespondWithError(c, http.StatusUnauthorized, "auth.unauthorized")
 			c.Abort()
 			return
 		}
-
-		// Extract claims and check for scope
-		claims := jwtToken.Claims.(jwt.MapClaims)
-		scopes, exists := claims["scope"].(string)
-		if !exists || !strings.Contains(scopes, scope) {
-			c.JSON(http.StatusForbidden, gin.H{"message": "Insufficient scope"})
+		if !HasScope(c, scope) {
+			api.RespondWithError(c, http.StatusForbidden, "auth.insufficient_scope")
 			c.Abort()
 			return
 		}
@@ -90,3 +130,62 @@ func CheckScope(scope string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// HasScope reports whether the JWT token set by JWTMiddleware grants the scope
+func HasScope(c *gin.Context, scope string) bool {
+	// Get the JWT token from the context
+	token, exists := c.Get("user")
+	if !exists {
+		return false
+	}
+
+	// Assert the token to the correct type
+	jwtToken, ok := token.(*jwt.Token)
+	if !ok {
+		return false
+	}
+
+	// Extract claims and look for the scope in the space-separated list
+	claims := jwtToken.Claims.(jwt.MapClaims)
+	scopes, _ := claims["scope"].(string)
+	for _, granted := range strings.Fields(scopes) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Subject returns the subject of the JWT token set by JWTMiddleware, or an empty string
+// without a token
+func Subject(c *gin.Context) string {
+	if token, ok := c.Get("user"); ok {
+		if jwtToken, ok := token.(*jwt.Token); ok {
+			if sub, ok := jwtToken.Claims.(jwt.MapClaims)["sub"].(string); ok {
+				return sub
+			}
+		}
+	}
+	return ""
+}
+
+// Groups returns the names of the groups listed in the JWT token set by JWTMiddleware
+func Groups(c *gin.Context) []string {
+	token, exists := c.Get("user")
+	if !exists {
+		return nil
+	}
+	jwtToken, ok := token.(*jwt.Token)
+	if !ok {
+		return nil
+	}
+	claims := jwtToken.Claims.(jwt.MapClaims)
+	values, _ := claims["groups"].([]interface{})
+	groups := make([]string, 0, len(values))
+	for _, value := range values {
+		if name, ok := value.(string); ok {
+			groups = append(groups, name)
+		}
+	}
+	return groups
+}
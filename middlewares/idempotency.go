@@ -0,0 +1,195 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"microservice/controllers/api"
+	"microservice/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyLockTimeout is how long an in-flight request holds its key, after which
+// the request is considered abandoned and a retry may take over the key
+const IdempotencyLockTimeout = time.Minute
+
+// MaxIdempotencyKeyLength is the maximum length of an Idempotency-Key header
+const MaxIdempotencyKeyLength = 255
+
+// MaxIdempotentBodySize is the maximum size in bytes of the body of a request sent with an
+// Idempotency-Key header, the largest body accepted by the endpoints, which is an import file
+const MaxIdempotentBodySize = api.MaxImportSize
+
+// responseRecorder keeps a copy of the response body written by handlers
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes requests with an Idempotency-Key header safe to retry. The response
+// to the first request is stored in db for ttl and replayed on retries with the same key.
+// Reusing a key for a different request is rejected with 409 Conflict, as are retries
+// while the first request is still in flight. Server errors are not stored so that the
+// request can be retried.
+func Idempotency(db *gorm.DB, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Idempotency-Key")
+		if header == "" {
+			c.Next()
+			return
+		}
+		if len(header) > MaxIdempotencyKeyLength {
+			api.RespondWithError(c, http.StatusBadRequest, "idempotency.invalid_key")
+			c.Abort()
+			return
+		}
+
+		// Fingerprint the request, restoring the body for the handler
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxIdempotentBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				api.RespondWithError(c, http.StatusRequestEntityTooLarge, "request.too_large")
+			} else {
+				api.RespondWithError(c, http.StatusBadRequest, "request.invalid_json")
+			}
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		// Claim the key, or replay the response stored for it. The key is hashed with the
+		// subject so that it fits the column whatever the length of the subject.
+		token := make([]byte, 16)
+		rand.Read(token)
+		key := sha256.Sum256([]byte(Subject(c) + ":" + header))
+		record := models.IdempotencyKey{
+			Key:         hex.EncodeToString(key[:]),
+			Fingerprint: fingerprint,
+			Token:       hex.EncodeToString(token),
+			CreatedAt:   time.Now(),
+			ExpiresAt:   time.Now().Add(ttl),
+		}
+		if !claimIdempotencyKey(c, db, &record) {
+			c.Abort()
+			return
+		}
+
+		// Process the request and store its response, unless another request took over the key
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The response is stored even when the client is gone, for its retries to replay it
+		held := db.WithContext(context.WithoutCancel(c.Request.Context())).Where("token = ?", record.Token)
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			held.Delete(&record)
+			return
+		}
+		headers, _ := json.Marshal(recorder.Header())
+		err = held.Model(&record).Updates(map[string]interface{}{
+			"status":  status,
+			"headers": string(headers),
+			"body":    recorder.body.Bytes(),
+		}).Error
+		if err != nil {
+			log.Println("Failed to store idempotent response:", err)
+		}
+	}
+}
+
+// claimIdempotencyKey stores the key as in flight. When it is already stored, it replays the
+// stored response or responds with a conflict, and reports that the request must not proceed.
+func claimIdempotencyKey(c *gin.Context, db *gorm.DB, record *models.IdempotencyKey) bool {
+	db = db.WithContext(c.Request.Context())
+	// Keys already stored are skipped rather than failing the insert, retries being expected
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "idempotency.failed")
+		return false
+	}
+	if result.RowsAffected == 1 {
+		return true
+	}
+
+	// KEY is a reserved word of MySQL, so the column is quoted
+	key := db.Statement.Quote("key")
+	var stored models.IdempotencyKey
+	if err := db.Where(key+" = ?", record.Key).First(&stored).Error; err != nil {
+		api.RespondWithError(c, http.StatusInternalServerError, "idempotency.failed")
+		return false
+	}
+
+	// Take over keys that expired or whose request was abandoned
+	expired := time.Now().After(stored.ExpiresAt)
+	abandoned := !stored.Completed() && time.Since(stored.CreatedAt) > IdempotencyLockTimeout
+	if expired || abandoned {
+		result := db.Model(&models.IdempotencyKey{}).
+			Where(key+" = ? AND token = ?", stored.Key, stored.Token).
+			Updates(map[string]interface{}{
+				"fingerprint": record.Fingerprint,
+				"token":       record.Token,
+				"status":      0,
+				"headers":     "",
+				"body":        []byte{},
+				"created_at":  record.CreatedAt,
+				"expires_at":  record.ExpiresAt,
+			})
+		if result.Error == nil && result.RowsAffected == 1 {
+			return true
+		}
+		api.RespondWithError(c, http.StatusConflict, "idempotency.in_progress")
+		return false
+	}
+
+	switch {
+	case stored.Fingerprint != record.Fingerprint:
+		api.RespondWithError(c, http.StatusConflict, "idempotency.key_reused")
+	case !stored.Completed():
+		c.Header("Retry-After", strconv.Itoa(int(IdempotencyLockTimeout.Seconds())))
+		api.RespondWithError(c, http.StatusConflict, "idempotency.in_progress")
+	default:
+		replay(c, &stored)
+	}
+	return false
+}
+
+// replay writes the stored response
+func replay(c *gin.Context, stored *models.IdempotencyKey) {
+	var headers http.Header
+	if err := json.Unmarshal([]byte(stored.Headers), &headers); err == nil {
+		for name, values := range headers {
+			c.Writer.Header()[name] = values
+		}
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Status(stored.Status)
+	c.Writer.Write(stored.Body)
+}
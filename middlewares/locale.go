@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"microservice/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Locale is a middleware that negotiates the response locale from the Accept-Language header.
+// The "lang" query parameter overrides the header.
+func Locale() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Accept-Language")
+		if lang := c.Query("lang"); lang != "" {
+			header = lang
+		}
+
+		locale := i18n.Negotiate(header)
+		c.Set(i18n.ContextKey, locale)
+		c.Header("Content-Language", locale)
+		c.Next()
+	}
+}
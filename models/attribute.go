@@ -0,0 +1,278 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Types of custom attributes
+const (
+	StringAttribute  = "string"
+	IntegerAttribute = "integer"
+	NumberAttribute  = "number"
+	BooleanAttribute = "boolean"
+	DateAttribute    = "date"
+)
+
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// metadataValidator validates attribute values against the rules of their definition
+var metadataValidator = validator.New()
+
+// sampleValues holds a value of each attribute type as decoded from JSON, to check that the
+// validation rules of a definition apply to its type
+var sampleValues = map[string]interface{}{
+	StringAttribute:  "",
+	IntegerAttribute: float64(0),
+	NumberAttribute:  float64(0),
+	BooleanAttribute: false,
+	DateAttribute:    "2006-01-02",
+}
+
+// Attribute defines a custom attribute stored in the metadata of users
+type Attribute struct {
+	Base
+	Name        string `json:"name" gorm:"not null" binding:"required,attributename,unique"`
+	Type        string `json:"type" gorm:"not null" binding:"required,oneof=string integer number boolean date"`
+	Required    bool   `json:"required"`
+	Validation  string `json:"validation,omitempty" binding:"omitempty,validationrule"` // Validator rules applied to values, e.g. "max=64"
+	ReadScope   string `json:"read_scope,omitempty"`                                    // Scope needed to read the attribute, empty when public
+	Description string `json:"description,omitempty"`
+}
+
+func init() {
+	RegisterValidation("attributename", validateAttributeName)
+	RegisterValidation("validationrule", validateValidationRule)
+}
+
+// AdjustFieldErrors adjusts field errors to remove the model prefix and convert to lowercase
+func (a *Attribute) AdjustFieldErrors(errMap map[string][]string) map[string][]string {
+	return a.Base.AdjustFieldErrors(errMap, a.ModelName())
+}
+
+// ModelName returns the name of the model
+func (a *Attribute) ModelName() string {
+	return "Attribute"
+}
+
+// ReadOnlyFields returns the JSON fields clients can never overwrite. Values are stored
+// under the attribute name, so it cannot change once defined.
+func (a *Attribute) ReadOnlyFields() []string {
+	return append(a.Base.ReadOnlyFields(), "name")
+}
+
+// Kind returns how query values of the attribute are parsed
+func (a *Attribute) Kind() FieldKind {
+	switch a.Type {
+	case IntegerAttribute:
+		return IntField
+	case NumberAttribute:
+		return FloatField
+	case BooleanAttribute:
+		return BoolField
+	default:
+		// Dates are stored as YYYY-MM-DD strings, which compare in chronological order
+		return StringField
+	}
+}
+
+// CheckValue returns the validation tag and parameter a value fails, or empty strings if valid
+func (a *Attribute) CheckValue(value interface{}) (tag, param string) {
+	if value == nil {
+		if a.Required {
+			return "required", ""
+		}
+		return "", ""
+	}
+
+	// Check the JSON value matches the attribute type
+	valid := false
+	switch v := value.(type) {
+	case string:
+		if a.Type == DateAttribute {
+			_, err := time.Parse("2006-01-02", v)
+			valid = err == nil
+		} else {
+			valid = a.Type == StringAttribute
+		}
+	case float64:
+		valid = a.Type == NumberAttribute || (a.Type == IntegerAttribute && v == math.Trunc(v))
+	case bool:
+		valid = a.Type == BooleanAttribute
+	}
+	if !valid {
+		return "attributetype", a.Type
+	}
+
+	// Apply the validation rules of the definition
+	if a.Validation != "" {
+		defer func() {
+			// The validator panics on rules that do not apply to the type of the value
+			if recover() != nil {
+				tag, param = "validationrule", a.Validation
+			}
+		}()
+		var fieldErrors validator.ValidationErrors
+		if errors.As(metadataValidator.Var(value, a.Validation), &fieldErrors) {
+			return fieldErrors[0].Tag(), fieldErrors[0].Param()
+		}
+	}
+	return "", ""
+}
+
+// AttributeSchema maps attribute names to their definition
+type AttributeSchema map[string]Attribute
+
+// LoadAttributeSchema loads the attribute definitions
+func LoadAttributeSchema(db *gorm.DB) (AttributeSchema, error) {
+	var attributes []Attribute
+	if err := db.Find(&attributes).Error; err != nil {
+		return nil, err
+	}
+	schema := make(AttributeSchema, len(attributes))
+	for _, attribute := range attributes {
+		schema[attribute.Name] = attribute
+	}
+	return schema, nil
+}
+
+// Validate reports an error for each metadata value not matching its definition,
+// each missing required attribute and each undefined attribute
+func (s AttributeSchema) Validate(sl validator.StructLevel, metadata Metadata) {
+	for name, attribute := range s {
+		if tag, param := attribute.CheckValue(metadata[name]); tag != "" {
+			sl.ReportError(metadata[name], "metadata."+name, "Metadata", tag, param)
+		}
+	}
+	for name, value := range metadata {
+		if _, ok := s[name]; !ok {
+			sl.ReportError(value, "metadata."+name, "Metadata", "attributeunknown", "")
+		}
+	}
+}
+
+// Readable reports whether a client granted the scopes checked by hasScope can read
+// the attribute. Undefined attributes are readable so that stale values can be fixed.
+func (s AttributeSchema) Readable(name string, hasScope func(scope string) bool) bool {
+	attribute, ok := s[name]
+	return !ok || attribute.ReadScope == "" || hasScope(attribute.ReadScope)
+}
+
+// Hide removes from metadata the attributes the client cannot read
+func (s AttributeSchema) Hide(metadata Metadata, hasScope func(scope string) bool) {
+	for name := range metadata {
+		if !s.Readable(name, hasScope) {
+			delete(metadata, name)
+		}
+	}
+}
+
+// Keep replaces the attributes the client cannot read in metadata with their stored values,
+// so that clients never overwrite or clear values hidden from them
+func (s AttributeSchema) Keep(metadata, stored Metadata, hasScope func(scope string) bool) Metadata {
+	if metadata == nil {
+		metadata = Metadata{}
+	}
+	for name := range s {
+		if s.Readable(name, hasScope) {
+			continue
+		}
+		if value, ok := stored[name]; ok {
+			metadata[name] = value
+		} else {
+			delete(metadata, name)
+		}
+	}
+	return metadata
+}
+
+// QueryFields returns the attributes readable with hasScope as filterable fields named
+// "metadata.<name>", extracting values from the JSON column of the dialect of db
+func (s AttributeSchema) QueryFields(db *gorm.DB, column string, hasScope func(scope string) bool) map[string]QueryField {
+	fields := make(map[string]QueryField, len(s))
+	for name, attribute := range s {
+		if !s.Readable(name, hasScope) {
+			continue
+		}
+		kind := attribute.Kind()
+		fields["metadata."+name] = QueryField{Column: jsonValue(db, column, name, kind), Kind: kind, Filterable: true}
+	}
+	return fields
+}
+
+// jsonValue returns the SQL expression extracting a key of a JSON column as a value of kind
+// SQLite drivers must be built with the sqlite_json tag.
+func jsonValue(db *gorm.DB, column, key string, kind FieldKind) string {
+	if db.Dialector.Name() != "postgres" {
+		return fmt.Sprintf("json_extract(%s, '$.%s')", column, key)
+	}
+	text := fmt.Sprintf("(%s::jsonb ->> '%s')", column, key)
+	switch kind {
+	case IntField, FloatField:
+		return text + "::numeric"
+	case BoolField:
+		return text + "::boolean"
+	default:
+		return text
+	}
+}
+
+// Metadata holds the custom attribute values of a record, stored as a JSON column
+type Metadata map[string]interface{}
+
+// Value serializes the metadata for the database
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+// Scan deserializes the metadata from the database
+func (m *Metadata) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into metadata", value)
+	}
+	*m = nil
+	return json.Unmarshal(data, m)
+}
+
+// validateAttributeName checks the attribute name can be used as a JSON key in queries
+func validateAttributeName(fl validator.FieldLevel) bool {
+	return attributeNamePattern.MatchString(fl.Field().String())
+}
+
+// validateValidationRule checks the validator rules of an attribute definition are well-formed
+// and apply to values of its type
+func validateValidationRule(fl validator.FieldLevel) (valid bool) {
+	defer func() {
+		// The validator panics on unknown or malformed tags, and on tags not applying to the type
+		if recover() != nil {
+			valid = false
+		}
+	}()
+	sample, ok := sampleValues[fl.Parent().FieldByName("Type").String()]
+	if !ok {
+		sample = ""
+	}
+	metadataValidator.Var(sample, fl.Field().String())
+	return true
+}
@@ -1,18 +1,136 @@
 package models
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"microservice/i18n"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
 )
 
 // Base defines common fields and methods for all models
 type Base struct {
-	ID        uint       `gorm:"primary_key" json:"id"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedAt *time.Time `sql:"index" json:"deleted_at,omitempty"`
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitzero" swaggertype:"string" format:"date-time"`
+	Version   uint           `gorm:"not null;default:1" json:"-"`
+	ETag      string         `gorm:"-" json:"etag,omitempty"`
+}
+
+// ErrVersionConflict is returned when a record was modified since it was read
+var ErrVersionConflict = errors.New("record was modified concurrently")
+
+// Errors returned when looking up a record by ID
+var (
+	ErrNotFound = errors.New("record not found")
+	ErrGone     = errors.New("record was deleted")
+)
+
+// Versioned is implemented by models supporting optimistic concurrency
+type Versioned interface {
+	CurrentVersion() uint
+	SetVersion(version uint)
+}
+
+// CurrentVersion returns the version the model was read at
+func (b *Base) CurrentVersion() uint {
+	return b.Version
+}
+
+// SetVersion sets the model version and refreshes its ETag
+func (b *Base) SetVersion(version uint) {
+	b.Version = version
+	b.ETag = b.StrongETag()
+}
+
+// StrongETag returns the strong entity tag of the stored representation
+func (b *Base) StrongETag() string {
+	return fmt.Sprintf(`"%d-%d"`, b.ID, b.Version)
+}
+
+// BeforeCreate initializes the version of new records
+func (b *Base) BeforeCreate(tx *gorm.DB) error {
+	if b.Version == 0 {
+		b.Version = 1
+	}
+	return nil
+}
+
+// AfterSave refreshes the ETag once the record is stored
+func (b *Base) AfterSave(tx *gorm.DB) error {
+	b.ETag = b.StrongETag()
+	return nil
+}
+
+// AfterFind sets the ETag of loaded records
+func (b *Base) AfterFind(tx *gorm.DB) error {
+	b.ETag = b.StrongETag()
+	return nil
+}
+
+// SaveVersioned saves the model only if the stored version still matches the one it was read at,
+// incrementing the version. It returns ErrVersionConflict otherwise.
+func SaveVersioned(db *gorm.DB, model Versioned) error {
+	return Transaction(db, func(tx *gorm.DB) error {
+		version := model.CurrentVersion()
+		result := tx.Model(model).Where("version = ?", version).UpdateColumn("version", gorm.Expr("version + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		model.SetVersion(version + 1)
+		return tx.Save(model).Error
+	})
+}
+
+// FindByID loads the record with the given ID into dest. It returns ErrNotFound when no such
+// record exists, and ErrGone when it is soft-deleted unless withTrashed is set.
+func FindByID(db *gorm.DB, dest interface{}, id uint, withTrashed bool) error {
+	if id == 0 {
+		return ErrNotFound
+	}
+	err := db.Unscoped().First(dest, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	deletedAt := reflect.Indirect(reflect.ValueOf(dest)).FieldByName("DeletedAt")
+	if deleted, ok := deletedAt.Interface().(gorm.DeletedAt); ok && deleted.Valid && !withTrashed {
+		return ErrGone
+	}
+	return nil
+}
+
+// TableName returns the table of the model
+func TableName(db *gorm.DB, model interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	return stmt.Schema.Table, nil
+}
+
+// Transaction runs fn in a transaction, joining the transaction db belongs to if any
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return fn(db)
+	}
+	return db.Transaction(fn)
 }
 
 // AdjustFieldErrors adjusts field errors to remove the model prefix and convert to lowercase
@@ -31,58 +149,66 @@ func (b *Base) ModelName() string {
 	return "Base"
 }
 
-// ValidateJSONRequestAndFields validates JSON request body and struct fields
-func (b *Base) ValidateJSONRequestAndFields(c *gin.Context, data interface{}) map[string][]string {
-	// Parse and validate JSON request body
-	if err := c.ShouldBindJSON(data); err != nil {
-		// If JSON is invalid, return error detailing required fields
-		errorMap := make(map[string][]string)
-		// Split the error message by newline and map each line to its corresponding field
-		for _, line := range strings.Split(err.Error(), "\n") {
-			// Skip empty lines
-			if strings.TrimSpace(line) == "" {
-				continue
-			}
-			// Extract the field name and error message from the error line
-			field := extractFieldName(line)
-			msg := extractErrorMessage(line)
-			if field != "" {
-				// Append error message to the list of errors for the field
-				errorMap[field] = append(errorMap[field], msg)
-			} else {
-				// If the field name cannot be extracted, add it to the "_json" key
-				errorMap["_json"] = append(errorMap["_json"], line)
-			}
-		}
-		return errorMap
+// ReadOnlyFields returns the JSON fields clients can never overwrite
+func (b *Base) ReadOnlyFields() []string {
+	return []string{"id", "created_at", "updated_at", "deleted_at", "etag"}
+}
+
+// ValidateJSONRequestAndFields validates JSON request body and struct fields, uniqueness
+// checks querying db
+func (b *Base) ValidateJSONRequestAndFields(c *gin.Context, db *gorm.DB, data interface{}) map[string][]string {
+	// Parse JSON request body
+	if errMap := b.DecodeJSONRequest(c, data); len(errMap) > 0 {
+		return errMap
 	}
 
-	// If everything is valid, return nil
+	// Validate struct fields, uniqueness checks running with the request context
+	return b.ValidateFields(c, db, data)
+}
+
+// DecodeJSONRequest decodes the JSON request body without validating struct fields
+func (b *Base) DecodeJSONRequest(c *gin.Context, data interface{}) map[string][]string {
+	if c.Request.Body == nil {
+		return FieldErrors(c, errors.New("missing request body"))
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(data); err != nil {
+		return FieldErrors(c, err)
+	}
 	return nil
 }
 
-// extractFieldName extracts the field name from the error message
-func extractFieldName(errorMessage string) string {
-	// Look for substrings like "Key: 'User.Name'" or "Key: 'User.Email'"
-	index := strings.Index(errorMessage, "Key: '")
-	if index != -1 {
-		// Extract the substring after "Key: '" and before "'"
-		start := index + len("Key: '")
-		end := strings.Index(errorMessage[start:], "'")
-		if end != -1 {
-			return errorMessage[start : start+end]
-		}
+// ValidateFields validates struct fields of already decoded data, uniqueness checks querying db
+func (b *Base) ValidateFields(c *gin.Context, db *gorm.DB, data interface{}) map[string][]string {
+	if err := ValidateStruct(WithDB(c.Request.Context(), db), data); err != nil {
+		return FieldErrors(c, err)
+	}
+	return nil
+}
+
+// ValidateStruct validates the fields of a record like the binding of gin, validations
+// querying the database of ctx set by WithDB
+func ValidateStruct(ctx context.Context, data interface{}) error {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		return v.StructCtx(ctx, data)
 	}
-	return ""
+	return binding.Validator.ValidateStruct(data)
 }
 
-// extractErrorMessage extracts the error message from the error string
-func extractErrorMessage(errorMessage string) string {
-	// Look for the "Error:" substring
-	index := strings.Index(errorMessage, "Error:")
-	if index != -1 {
-		// Extract the message that follows "Error:"
-		return strings.TrimSpace(errorMessage[index+len("Error:"):])
+// FieldErrors maps a binding or validation error to translated messages per field
+func FieldErrors(c *gin.Context, err error) map[string][]string {
+	errorMap := make(map[string][]string)
+	locale := i18n.FromContext(c)
+
+	// Map each failed field to its translated error message
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		for _, fe := range validationErrors {
+			errorMap[fe.Namespace()] = append(errorMap[fe.Namespace()], i18n.TranslateFieldError(locale, fe))
+		}
+		return errorMap
 	}
-	return ""
+
+	// If the body could not be decoded, add the error to the "_json" key
+	errorMap["_json"] = append(errorMap["_json"], err.Error())
+	return errorMap
 }
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"gorm.io/gorm"
+)
+
+// ErrBlobNotFound is returned when no blob is stored under a key
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore stores binary objects such as avatars under slash-separated keys
+type BlobStore interface {
+	// Put stores data under key, replacing any existing blob
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// Get opens the blob stored under key and returns its content type
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	// Delete removes the blob stored under key, if any
+	Delete(ctx context.Context, key string) error
+}
+
+// blobsPlugin registers a blob store with a database, for the hooks of permanently deleted
+// records to delete their blobs
+type blobsPlugin struct {
+	BlobStore
+}
+
+// Name returns the name the store is registered under
+func (blobsPlugin) Name() string {
+	return "blobs"
+}
+
+// Initialize does nothing, the store being looked up by the hooks
+func (blobsPlugin) Initialize(*gorm.DB) error {
+	return nil
+}
+
+// UseBlobs registers the blob store of db
+func UseBlobs(db *gorm.DB, blobs BlobStore) error {
+	return db.Use(blobsPlugin{blobs})
+}
+
+// BlobsOf returns the blob store registered with db, nil when blob storage is unavailable
+func BlobsOf(db *gorm.DB) BlobStore {
+	if plugin, ok := db.Config.Plugins[blobsPlugin{}.Name()].(blobsPlugin); ok {
+		return plugin.BlobStore
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidClient is returned when a client ID and secret do not match a client
+var ErrInvalidClient = errors.New("invalid client credentials")
+
+// Client is an application obtaining tokens for itself with the client credentials grant.
+// Its secret is only revealed when the client is created.
+type Client struct {
+	Base
+	Name       string `json:"name" gorm:"not null" binding:"required,max=100"`
+	ClientID   string `json:"client_id" gorm:"not null"`
+	SecretHash string `json:"-" gorm:"not null"`
+	// Space-separated scopes granted to the tokens of the client
+	Scope string `json:"scope"`
+}
+
+// NewClient returns a client with a new ID and secret, and the secret
+func NewClient(name, scope string) (*Client, string, error) {
+	id := make([]byte, 12)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	client := &Client{Name: name, ClientID: hex.EncodeToString(id), Scope: scope}
+	client.SecretHash = hashClientSecret(hex.EncodeToString(secret))
+	return client, hex.EncodeToString(secret), nil
+}
+
+// AuthenticateClient returns the client with the ID and secret, or ErrInvalidClient
+func AuthenticateClient(db *gorm.DB, clientID, secret string) (*Client, error) {
+	var client Client
+	err := db.Where("client_id = ?", clientID).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashClientSecret(secret))) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return &client, nil
+}
+
+// hashClientSecret returns the hash client secrets are stored as. Secrets are random, so a
+// fast hash is enough.
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
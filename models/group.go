@@ -0,0 +1,173 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Types of group members
+const (
+	UserMember  = "user"
+	GroupMember = "group"
+)
+
+// Errors returned when changing group memberships
+var (
+	ErrAlreadyMember = errors.New("already a member of the group")
+	ErrGroupCycle    = errors.New("group membership would create a cycle")
+)
+
+// Group is a team of users, which may itself contain groups. Members of a nested group
+// are effective members of every group containing it.
+type Group struct {
+	Base
+	Name        string `json:"name" gorm:"not null" binding:"required,max=100,unique"`
+	Description string `json:"description,omitempty" binding:"max=1000"`
+}
+
+// GroupMembership records that a user or a group is a direct member of a group
+type GroupMembership struct {
+	GroupID    uint      `gorm:"primaryKey;autoIncrement:false"`
+	MemberType string    `gorm:"primaryKey"`
+	MemberID   uint      `gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt  time.Time // When the member was added
+}
+
+// AdjustFieldErrors adjusts field errors to remove the model prefix and convert to lowercase
+func (g *Group) AdjustFieldErrors(errMap map[string][]string) map[string][]string {
+	return g.Base.AdjustFieldErrors(errMap, g.ModelName())
+}
+
+// ModelName returns the name of the model
+func (g *Group) ModelName() string {
+	return "Group"
+}
+
+// QueryFields returns the fields groups can be filtered, sorted and selected by
+func (g *Group) QueryFields() map[string]QueryField {
+	fields := g.Base.QueryFields()
+	fields["name"] = QueryField{Column: "name", Kind: StringField, Filterable: true, Sortable: true, Selectable: true}
+	fields["description"] = QueryField{Column: "description", Kind: StringField, Filterable: true, Selectable: true}
+	return fields
+}
+
+// AddGroupMember adds a user or a group as a direct member of a group. It returns
+// ErrAlreadyMember for existing members, and ErrGroupCycle when the group would end up
+// containing itself.
+func AddGroupMember(db *gorm.DB, groupID uint, memberType string, memberID uint) error {
+	return Transaction(db, func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&GroupMembership{}).
+			Where("group_id = ? AND member_type = ? AND member_id = ?", groupID, memberType, memberID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyMember
+		}
+
+		// A group cannot contain itself, directly or through its nested groups
+		if memberType == GroupMember {
+			descendants, err := nestedGroupIDs(tx, []uint{memberID}, "group_id", "member_id")
+			if err != nil {
+				return err
+			}
+			if memberID == groupID || descendants[groupID] {
+				return ErrGroupCycle
+			}
+		}
+
+		return tx.Create(&GroupMembership{GroupID: groupID, MemberType: memberType, MemberID: memberID}).Error
+	})
+}
+
+// RemoveGroupMember removes a direct member of a group and reports whether it was a member
+func RemoveGroupMember(db *gorm.DB, groupID uint, memberType string, memberID uint) (bool, error) {
+	result := db.Where("group_id = ? AND member_type = ? AND member_id = ?", groupID, memberType, memberID).
+		Delete(&GroupMembership{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// EffectiveGroupIDs returns the groups a user belongs to directly or through nested groups
+func EffectiveGroupIDs(db *gorm.DB, userID uint) ([]uint, error) {
+	var direct []uint
+	err := liveMemberships(db, "group_id").
+		Where("group_memberships.member_type = ? AND group_memberships.member_id = ?", UserMember, userID).
+		Pluck("group_memberships.group_id", &direct).Error
+	if err != nil {
+		return nil, err
+	}
+	ancestors, err := nestedGroupIDs(db, direct, "member_id", "group_id")
+	if err != nil {
+		return nil, err
+	}
+	return groupIDs(ancestors, direct), nil
+}
+
+// EffectiveMemberIDs returns the users belonging to a group directly or through nested groups
+func EffectiveMemberIDs(db *gorm.DB, groupID uint) ([]uint, error) {
+	descendants, err := nestedGroupIDs(db, []uint{groupID}, "group_id", "member_id")
+	if err != nil {
+		return nil, err
+	}
+	var users []uint
+	err = db.Model(&GroupMembership{}).
+		Where("member_type = ? AND group_id IN (?)", UserMember, groupIDs(descendants, []uint{groupID})).
+		Pluck("DISTINCT member_id", &users).Error
+	return users, err
+}
+
+// nestedGroupIDs walks group memberships from the start groups, from the from column to
+// the to column, and returns the groups reached. Visited groups are skipped, so that
+// cycles left by concurrent changes cannot loop forever.
+func nestedGroupIDs(db *gorm.DB, start []uint, from, to string) (map[uint]bool, error) {
+	visited := make(map[uint]bool)
+	for _, id := range start {
+		visited[id] = true
+	}
+	reached := make(map[uint]bool)
+	for frontier := start; len(frontier) > 0; {
+		var next []uint
+		err := liveMemberships(db, to).
+			Where("group_memberships.member_type = ? AND group_memberships."+from+" IN (?)", GroupMember, frontier).
+			Pluck("group_memberships."+to, &next).Error
+		if err != nil {
+			return nil, err
+		}
+		frontier = nil
+		for _, id := range next {
+			if !visited[id] {
+				visited[id] = true
+				reached[id] = true
+				frontier = append(frontier, id)
+			}
+		}
+	}
+	return reached, nil
+}
+
+// liveMemberships selects memberships whose group in column is not soft-deleted.
+// The table name is quoted as GROUPS is a reserved word in MySQL.
+func liveMemberships(db *gorm.DB, column string) *gorm.DB {
+	groups := db.Statement.Quote("groups")
+	return db.Table("group_memberships").
+		Joins(fmt.Sprintf("JOIN %[1]s ON %[1]s.id = group_memberships.%[2]s AND %[1]s.deleted_at IS NULL", groups, column))
+}
+
+// groupIDs returns the IDs of the set followed by the extra IDs not in it
+func groupIDs(set map[uint]bool, extra []uint) []uint {
+	ids := make([]uint, 0, len(set)+len(extra))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	for _, id := range extra {
+		if !set[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
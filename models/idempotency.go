@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey stores the response of a request sent with an Idempotency-Key header
+type IdempotencyKey struct {
+	Key         string    `gorm:"primaryKey"` // SHA-256 of the client key, scoped to the client identity
+	Fingerprint string    `gorm:"not null"`   // Hash of the request method, URL and body
+	Token       string    `gorm:"not null"`   // Random token of the request holding the key
+	Status      int       // Response status code, 0 while the request is in flight
+	Headers     string    `gorm:"type:text"` // Response headers as JSON
+	Body        []byte    // Response body
+	CreatedAt   time.Time // When the request was first received
+	ExpiresAt   time.Time `gorm:"index"` // When the key can be reused
+}
+
+// Completed reports whether the response of the request was stored
+func (k *IdempotencyKey) Completed() bool {
+	return k.Status != 0
+}
+
+// PurgeExpiredIdempotencyKeys deletes the keys past their expiry and returns how many were deleted
+func PurgeExpiredIdempotencyKeys(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Where("expires_at < ?", now).Delete(&IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Account statuses of users
+const (
+	StatusInvited     = "invited"     // Created by invitation, waiting for the user to set a password
+	StatusActive      = "active"      // Allowed to sign in
+	StatusSuspended   = "suspended"   // Temporarily barred from signing in, until the optional end date
+	StatusDeactivated = "deactivated" // Closed, until reactivated
+)
+
+// StatusTransitions lists the statuses each status can change to
+var StatusTransitions = map[string][]string{
+	StatusInvited:     {StatusActive, StatusDeactivated},
+	StatusActive:      {StatusSuspended, StatusDeactivated},
+	StatusSuspended:   {StatusActive, StatusDeactivated},
+	StatusDeactivated: {StatusActive},
+}
+
+// Errors returned when changing the status of a user
+var (
+	ErrInvalidTransition = errors.New("status transition is not allowed")
+	ErrInvalidInvitation = errors.New("invitation token is invalid or expired")
+)
+
+// Lifecycle holds the account status of a user, which clients only change through
+// status transitions and invitations
+type Lifecycle struct {
+	Status          string     `json:"status" gorm:"not null;default:'active';index"`
+	SuspendedReason string     `json:"suspended_reason,omitempty"`
+	SuspendedUntil  *time.Time `json:"suspended_until,omitempty"`
+	// Bcrypt hash of the password, set when accepting the invitation
+	PasswordHash string `json:"-"`
+	// SHA-256 hash of the pending invitation token, which is only revealed once
+	InvitationHash      string     `json:"-" gorm:"index"`
+	InvitationExpiresAt *time.Time `json:"-"`
+}
+
+// CanTransition reports whether the status can change to the given status
+func (l *Lifecycle) CanTransition(to string) bool {
+	for _, status := range StatusTransitions[l.Status] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition changes the status, recording the reason and optional end date of suspensions.
+// It returns ErrInvalidTransition when the state machine does not allow the change.
+func (l *Lifecycle) Transition(to, reason string, until *time.Time) error {
+	if !l.CanTransition(to) {
+		return ErrInvalidTransition
+	}
+	l.Status = to
+	l.SuspendedReason = ""
+	l.SuspendedUntil = nil
+	if to == StatusSuspended {
+		l.SuspendedReason = reason
+		l.SuspendedUntil = until
+	}
+	if to != StatusInvited {
+		l.InvitationHash = ""
+		l.InvitationExpiresAt = nil
+	}
+	return nil
+}
+
+// CanSignIn reports whether the user may obtain and use tokens
+func (l *Lifecycle) CanSignIn() bool {
+	return l.Status == StatusActive
+}
+
+// Invite resets the account to the invited status and returns a new invitation token valid
+// for ttl, replacing any previous one
+func (l *Lifecycle) Invite(ttl time.Duration) (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(ttl)
+	l.Status = StatusInvited
+	l.PasswordHash = ""
+	l.InvitationHash = HashInvitation(hex.EncodeToString(token))
+	l.InvitationExpiresAt = &expiresAt
+	return hex.EncodeToString(token), nil
+}
+
+// AcceptInvitation sets the password of an invited user and activates the account
+func (l *Lifecycle) AcceptInvitation(password string) error {
+	if l.Status != StatusInvited || l.InvitationExpiresAt == nil || time.Now().After(*l.InvitationExpiresAt) {
+		return ErrInvalidInvitation
+	}
+	if err := l.SetPassword(password); err != nil {
+		return err
+	}
+	return l.Transition(StatusActive, "", nil)
+}
+
+// SetPassword replaces the password
+func (l *Lifecycle) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	l.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword reports whether the password matches. Users without a password, and empty
+// passwords, never match.
+func (l *Lifecycle) CheckPassword(password string) bool {
+	if l.PasswordHash == "" || password == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(l.PasswordHash), []byte(password)) == nil
+}
+
+// liftExpiredSuspension reactivates suspended users whose suspension has ended. The change
+// is stored the next time the user is saved.
+func (l *Lifecycle) liftExpiredSuspension(now time.Time) {
+	if l.Status == StatusSuspended && l.SuspendedUntil != nil && !now.Before(*l.SuspendedUntil) {
+		l.Transition(StatusActive, "", nil)
+	}
+}
+
+// HashInvitation returns the hash invitation tokens are stored and looked up by
+func HashInvitation(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
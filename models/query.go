@@ -0,0 +1,58 @@
+package models
+
+// FieldKind describes how query values of a field are parsed
+type FieldKind int
+
+const (
+	StringField FieldKind = iota
+	IntField
+	TimeField
+	FloatField
+	BoolField
+	JSONField
+)
+
+// QueryField describes a model field clients may filter, sort or select, keyed by its JSON name
+type QueryField struct {
+	Column     string    // Database column
+	Kind       FieldKind // Type of the field values
+	Filterable bool      // Whether the field can be filtered on
+	Sortable   bool      // Whether the field can be sorted by
+	Selectable bool      // Whether the field can be requested in sparse fieldsets
+}
+
+// Queryable is implemented by models exposing list filtering, sorting and sparse fieldsets
+type Queryable interface {
+	QueryFields() map[string]QueryField
+}
+
+// QueryFieldSet is a set of queryable fields assembled at request time, such as the
+// fields of a model extended with its custom attributes
+type QueryFieldSet map[string]QueryField
+
+// QueryFields returns the fields of the set
+func (s QueryFieldSet) QueryFields() map[string]QueryField {
+	return s
+}
+
+// Expandable is implemented by models with relations clients may embed with ?expand=
+type Expandable interface {
+	Expansions() map[string]string
+}
+
+// QueryFields returns the queryable fields common to all models
+func (b *Base) QueryFields() map[string]QueryField {
+	return map[string]QueryField{
+		"id":         {Column: "id", Kind: IntField, Filterable: true, Sortable: true, Selectable: true},
+		"created_at": {Column: "created_at", Kind: TimeField, Filterable: true, Sortable: true, Selectable: true},
+		"updated_at": {Column: "updated_at", Kind: TimeField, Filterable: true, Sortable: true, Selectable: true},
+		"deleted_at": {Column: "deleted_at", Kind: TimeField, Filterable: true, Selectable: true},
+		"etag":       {Column: "version", Kind: IntField, Selectable: true},
+	}
+}
+
+// Expansions returns the relations that can be embedded, mapping the expansion name
+// (also its JSON field) to the association preloaded for it
+func (b *Base) Expansions() map[string]string {
+	return map[string]string{}
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// SearchHit is a record matching a full-text search
+type SearchHit struct {
+	ID         uint              // Primary key of the matching record
+	Rank       float64           // Relevance, higher is better
+	Highlights map[string]string // Searchable fields, HTML-escaped, with the matched fragments highlighted
+}
+
+// SearchIndex is a full-text search backend kept in sync by the model hooks
+type SearchIndex interface {
+	// Setup indexes the existing records of a table, whose index structures are created by migrations
+	Setup(db *gorm.DB, table string, fields []string) error
+	// Index adds or replaces the entry of a record, fields being ordered by decreasing weight
+	Index(db *gorm.DB, table string, id interface{}, fields []string, document map[string]string) error
+	// Remove deletes the entry of a record
+	Remove(db *gorm.DB, table string, id interface{}) error
+	// Search returns a page of hits ordered by relevance and the total number of hits
+	Search(db *gorm.DB, table string, fields []string, query string, limit, offset int) ([]SearchHit, int, error)
+}
+
+// Searchable is implemented by models indexed for full-text search
+type Searchable interface {
+	SearchFields() []string
+}
+
+// searchPlugin registers a search backend with a database, for the model hooks to keep it in sync
+type searchPlugin struct {
+	SearchIndex
+}
+
+// Name returns the name the backend is registered under
+func (searchPlugin) Name() string {
+	return "search"
+}
+
+// Initialize does nothing, the backend being looked up by the hooks
+func (searchPlugin) Initialize(*gorm.DB) error {
+	return nil
+}
+
+// UseSearch registers the search backend of db
+func UseSearch(db *gorm.DB, index SearchIndex) error {
+	return db.Use(searchPlugin{index})
+}
+
+// SearchOf returns the search backend registered with db, nil when full-text search is unavailable
+func SearchOf(db *gorm.DB) SearchIndex {
+	if plugin, ok := db.Config.Plugins[searchPlugin{}.Name()].(searchPlugin); ok {
+		return plugin.SearchIndex
+	}
+	return nil
+}
+
+// indexForSearch adds or replaces the search index entry of the record saved by tx
+func indexForSearch(tx *gorm.DB, model Searchable) error {
+	search := SearchOf(tx)
+	if search == nil {
+		return nil
+	}
+	stmt := tx.Statement
+	fields := model.SearchFields()
+	document := make(map[string]string)
+	for _, name := range fields {
+		if field := stmt.Schema.LookUpField(name); field != nil {
+			value, _ := field.ValueOf(stmt.Context, reflect.ValueOf(model))
+			document[name], _ = value.(string)
+		}
+	}
+	return search.Index(tx.Session(&gorm.Session{NewDB: true}), stmt.Table, primaryKey(tx, model), fields, document)
+}
+
+// removeFromSearch deletes the search index entry of the record deleted by tx
+func removeFromSearch(tx *gorm.DB, model interface{}) error {
+	search := SearchOf(tx)
+	if search == nil {
+		return nil
+	}
+	return search.Remove(tx.Session(&gorm.Session{NewDB: true}), tx.Statement.Table, primaryKey(tx, model))
+}
+
+// primaryKey returns the primary key value of the record handled by tx
+func primaryKey(tx *gorm.DB, model interface{}) interface{} {
+	value, _ := tx.Statement.Schema.PrioritizedPrimaryField.ValueOf(tx.Statement.Context, reflect.ValueOf(model))
+	return value
+}
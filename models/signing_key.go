@@ -0,0 +1,83 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnknownSigningKey is returned for keys that do not exist or no longer verify tokens
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// SigningKey is a secret signing tokens, named by the kid header of the tokens it signed.
+// The newest key that is not retired signs new tokens, while retired keys keep verifying
+// the tokens they signed until those expire.
+type SigningKey struct {
+	ID        string     `json:"id" gorm:"primaryKey"`
+	Secret    string     `json:"-" gorm:"not null"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// ActiveSigningKey returns the key signing new tokens, or nil before any key was created
+func ActiveSigningKey(db *gorm.DB) (*SigningKey, error) {
+	var key SigningKey
+	err := db.Where("retired_at IS NULL").Order("created_at DESC").First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FindSigningKey returns the key verifying tokens signed with it, which retired keys do for
+// the given period after being retired. It returns ErrUnknownSigningKey otherwise.
+func FindSigningKey(db *gorm.DB, id string, retention time.Duration) (*SigningKey, error) {
+	var key SigningKey
+	err := db.Where("id = ? AND (retired_at IS NULL OR retired_at > ?)", id, time.Now().Add(-retention)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownSigningKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RotateSigningKeys creates the key signing new tokens and retires the previous ones. Keys
+// retired for longer than the retention period, which no longer verify tokens, are deleted.
+// It returns the new key and the number of deleted keys.
+func RotateSigningKeys(db *gorm.DB, retention time.Duration) (*SigningKey, int64, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, 0, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	key := &SigningKey{ID: hex.EncodeToString(id), Secret: hex.EncodeToString(secret), CreatedAt: now}
+	var deleted int64
+	err := Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Model(&SigningKey{}).Where("retired_at IS NULL").Update("retired_at", now).Error; err != nil {
+			return err
+		}
+		result := tx.Where("retired_at < ?", now.Add(-retention)).Delete(&SigningKey{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Create(key).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return key, deleted, nil
+}
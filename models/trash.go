@@ -0,0 +1,44 @@
+package models
+
+import (
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Restore undeletes a soft-deleted model if the stored version still matches the one it
+// was read at, incrementing the version. It returns ErrVersionConflict otherwise.
+func Restore(db *gorm.DB, model Versioned) error {
+	version := model.CurrentVersion()
+	result := db.Unscoped().Model(model).Where("version = ?", version).Updates(map[string]interface{}{
+		"deleted_at": nil,
+		"version":    version + 1,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	model.SetVersion(version + 1)
+	return nil
+}
+
+// PurgeTrashed permanently deletes the records of the model soft-deleted before the given time,
+// one by one so that delete hooks run, and returns the number of purged records
+func PurgeTrashed(db *gorm.DB, model interface{}, before time.Time) (int, error) {
+	records := reflect.New(reflect.SliceOf(reflect.TypeOf(model).Elem()))
+	if err := db.Unscoped().Where("deleted_at < ?", before).Find(records.Interface()).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for i := 0; i < records.Elem().Len(); i++ {
+		if err := db.Unscoped().Delete(records.Elem().Index(i).Addr().Interface()).Error; err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
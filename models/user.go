@@ -1,15 +1,34 @@
 package models
 
 import (
-	"github.com/jinzhu/gorm"
+	"context"
+	"fmt"
+	"log"
+	"microservice/imaging"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
 )
 
 // User represents a user model
 type User struct {
 	Base
-	Name  string `json:"name" gorm:"not null" binding:"required"`
-	Email string `json:"email" gorm:"not null;unique" binding:"required,email"`
-	Age   int    `json:"age"`
+	Lifecycle
+	Name  string `json:"name" gorm:"not null" binding:"required,personname"`
+	Email string `json:"email" gorm:"not null" binding:"required,email,notdisposable"`
+	Age   int    `json:"age" binding:"age"`
+	// Values of the custom attributes defined by the attribute schema
+	Metadata Metadata `json:"metadata,omitempty" gorm:"type:text;not null;default:'{}'"`
+	// Blob key of the avatar, its thumbnails being stored under AvatarKey
+	Avatar    string `json:"-"`
+	AvatarURL string `json:"avatar_url,omitempty" gorm:"-"`
+}
+
+func init() {
+	RegisterStructValidation(User{})
 }
 
 // AdjustFieldErrors adjusts field errors to remove the model prefix and convert to lowercase
@@ -22,4 +41,140 @@ func (u *User) ModelName() string {
 	return "User"
 }
 
-var DB *gorm.DB
+// ReadOnlyFields returns the JSON fields clients can never overwrite
+func (u *User) ReadOnlyFields() []string {
+	return append(u.Base.ReadOnlyFields(), "avatar_url", "status", "suspended_reason", "suspended_until")
+}
+
+// QueryFields returns the fields users can be filtered, sorted and selected by
+func (u *User) QueryFields() map[string]QueryField {
+	fields := u.Base.QueryFields()
+	fields["name"] = QueryField{Column: "name", Kind: StringField, Filterable: true, Sortable: true, Selectable: true}
+	fields["email"] = QueryField{Column: "email", Kind: StringField, Filterable: true, Sortable: true, Selectable: true}
+	fields["age"] = QueryField{Column: "age", Kind: IntField, Filterable: true, Sortable: true, Selectable: true}
+	fields["metadata"] = QueryField{Column: "metadata", Kind: JSONField, Selectable: true}
+	fields["avatar_url"] = QueryField{Column: "avatar", Kind: StringField, Selectable: true}
+	fields["status"] = QueryField{Column: "status", Kind: StringField, Filterable: true, Sortable: true, Selectable: true}
+	fields["suspended_reason"] = QueryField{Column: "suspended_reason", Kind: StringField, Selectable: true}
+	fields["suspended_until"] = QueryField{Column: "suspended_until", Kind: TimeField, Filterable: true, Selectable: true}
+	return fields
+}
+
+// SearchFields returns the fields indexed for full-text search, by decreasing weight
+func (u *User) SearchFields() []string {
+	return []string{"name", "email"}
+}
+
+// NormalizeEmail returns the email in the lower case emails are stored and compared in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(email)
+}
+
+// AvatarKey returns the blob key of the avatar thumbnail of the given size
+func (u *User) AvatarKey(size string) string {
+	ext := path.Ext(u.Avatar)
+	return strings.TrimSuffix(u.Avatar, ext) + "/" + size + ext
+}
+
+// BeforeCreate initializes the version and the status of new users
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if err := u.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+	if u.Status == "" {
+		u.Status = StatusActive
+	}
+	return nil
+}
+
+// AfterFind sets the ETag and the avatar URL of loaded users, and lifts ended suspensions
+func (u *User) AfterFind(tx *gorm.DB) error {
+	if err := u.Base.AfterFind(tx); err != nil {
+		return err
+	}
+	u.setAvatarURL()
+	u.liftExpiredSuspension(time.Now())
+	return nil
+}
+
+// AfterSave refreshes the ETag, the avatar URL and the search index entry of the user
+func (u *User) AfterSave(tx *gorm.DB) error {
+	if err := u.Base.AfterSave(tx); err != nil {
+		return err
+	}
+	u.setAvatarURL()
+	return indexForSearch(tx, u)
+}
+
+// AfterDelete removes the user from the search index, and its avatar and group memberships
+// once permanently deleted
+func (u *User) AfterDelete(tx *gorm.DB) error {
+	if err := removeFromSearch(tx, u); err != nil {
+		return err
+	}
+	db := tx.Session(&gorm.Session{NewDB: true})
+	var count int64
+	if err := db.Unscoped().Model(&User{}).Where("id = ?", u.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	u.DeleteAvatar(tx.Statement.Context, BlobsOf(tx))
+	return db.Where("member_type = ? AND member_id = ?", UserMember, u.ID).Delete(&GroupMembership{}).Error
+}
+
+// DeleteAvatar removes the avatar thumbnails of the user from the blob store, logging failures
+// as the thumbnails are unreachable once the user no longer refers to them
+func (u *User) DeleteAvatar(ctx context.Context, blobs BlobStore) {
+	if u.Avatar == "" || blobs == nil {
+		return
+	}
+	for size := range imaging.ThumbnailSizes {
+		if err := blobs.Delete(ctx, u.AvatarKey(size)); err != nil {
+			log.Println("Failed to delete avatar:", err)
+		}
+	}
+}
+
+// setAvatarURL sets the URL the avatar is served from, which changes with each upload
+func (u *User) setAvatarURL() {
+	u.AvatarURL = ""
+	if u.Avatar != "" {
+		u.AvatarURL = fmt.Sprintf("/api/v1/users/%d/avatar?v=%s", u.ID, path.Base(strings.TrimSuffix(u.Avatar, path.Ext(u.Avatar))))
+	}
+}
+
+// ValidateStruct validates rules spanning multiple user fields
+func (u User) ValidateStruct(ctx context.Context, sl validator.StructLevel) {
+	// The name must not simply repeat the email address
+	if u.Name != "" && strings.EqualFold(u.Name, u.Email) {
+		sl.ReportError(u.Name, "name", "Name", "nefield", "email")
+	}
+
+	// The checks against the stored users are made by the caller, such as the user service
+	checks, ok := ctx.Value(userChecksKey{}).(UserChecks)
+	if !ok {
+		return
+	}
+	if checks.EmailTaken {
+		sl.ReportError(u.Email, "email", "Email", "unique", "")
+	}
+
+	// Custom attributes must match the attribute schema
+	checks.Schema.Validate(sl, u.Metadata)
+}
+
+// userChecksKey is the context key of the checks of a user against the stored users
+type userChecksKey struct{}
+
+// UserChecks are the facts about the stored users the validation of a user reports
+type UserChecks struct {
+	Schema     AttributeSchema // Definitions of the custom attributes
+	EmailTaken bool            // Whether another active user has the email
+}
+
+// WithUserChecks returns a copy of ctx carrying the checks the validation of users reports
+func WithUserChecks(ctx context.Context, checks UserChecks) context.Context {
+	return context.WithValue(ctx, userChecksKey{}, checks)
+}
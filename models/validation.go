@@ -0,0 +1,177 @@
+package models
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Age bounds enforced by the "age" validation tag
+const (
+	MinAge = 0
+	MaxAge = 150
+)
+
+// StructValidator is implemented by models with cross-field validation rules, ctx being
+// the context the validation runs with
+type StructValidator interface {
+	ValidateStruct(ctx context.Context, sl validator.StructLevel)
+}
+
+var (
+	validations       = map[string]validator.FuncCtx{}
+	structValidations []StructValidator
+
+	personNamePattern = regexp.MustCompile(`^[\p{L}\p{M}' .-]+$`)
+
+	disposableMu      sync.RWMutex
+	disposableDomains = map[string]struct{}{}
+)
+
+func init() {
+	RegisterValidation("age", validateAge)
+	RegisterValidation("personname", validatePersonName)
+	RegisterValidation("notdisposable", validateNotDisposable)
+	RegisterValidationCtx("unique", validateUnique)
+	RegisterValidation("future", validateFuture)
+}
+
+// RegisterValidation registers a custom field validation tag
+func RegisterValidation(tag string, fn validator.Func) {
+	validations[tag] = func(_ context.Context, fl validator.FieldLevel) bool {
+		return fn(fl)
+	}
+}
+
+// RegisterValidationCtx registers a custom field validation tag needing the context the
+// validation runs with
+func RegisterValidationCtx(tag string, fn validator.FuncCtx) {
+	validations[tag] = fn
+}
+
+// RegisterStructValidation registers the struct-level validation of a model
+func RegisterStructValidation(model StructValidator) {
+	structValidations = append(structValidations, model)
+}
+
+// RegisterValidations installs every registered validation on the validator engine
+func RegisterValidations(v *validator.Validate) error {
+	for tag, fn := range validations {
+		if err := v.RegisterValidationCtx(tag, fn); err != nil {
+			return err
+		}
+	}
+	for _, model := range structValidations {
+		v.RegisterStructValidationCtx(func(ctx context.Context, sl validator.StructLevel) {
+			sl.Current().Interface().(StructValidator).ValidateStruct(ctx, sl)
+		}, model)
+	}
+	return nil
+}
+
+// LoadDisposableDomains loads the denylist of disposable email domains, one domain per line
+func LoadDisposableDomains(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Skip blank lines and comments
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	disposableMu.Lock()
+	disposableDomains = domains
+	disposableMu.Unlock()
+	return nil
+}
+
+// validateAge checks that the age is within MinAge and MaxAge
+func validateAge(fl validator.FieldLevel) bool {
+	age := fl.Field().Int()
+	return age >= MinAge && age <= MaxAge
+}
+
+// validatePersonName checks that the name only contains letters, spaces, apostrophes, dots and hyphens
+func validatePersonName(fl validator.FieldLevel) bool {
+	return personNamePattern.MatchString(fl.Field().String())
+}
+
+// validateNotDisposable checks that the email domain is not on the disposable domain denylist
+func validateNotDisposable(fl validator.FieldLevel) bool {
+	email := fl.Field().String()
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return true
+	}
+
+	disposableMu.RLock()
+	defer disposableMu.RUnlock()
+	_, disposable := disposableDomains[strings.ToLower(email[at+1:])]
+	return !disposable
+}
+
+// validateFuture checks that the time is in the future
+func validateFuture(fl validator.FieldLevel) bool {
+	t, ok := fl.Field().Interface().(time.Time)
+	return ok && t.After(time.Now())
+}
+
+// dbKey is the context key of the database validations query
+type dbKey struct{}
+
+// WithDB returns a copy of ctx carrying the database validations such as "unique" query
+func WithDB(ctx context.Context, db *gorm.DB) context.Context {
+	return context.WithValue(ctx, dbKey{}, db)
+}
+
+// validateUnique checks that no other record of the model has the same column value,
+// ignoring soft-deleted records. The column defaults to the field's column name and can be set with the tag parameter.
+// The check is skipped when ctx carries no database.
+func validateUnique(ctx context.Context, fl validator.FieldLevel) bool {
+	db, _ := ctx.Value(dbKey{}).(*gorm.DB)
+	if db == nil {
+		return true
+	}
+
+	column := fl.Param()
+	if column == "" {
+		column = db.NamingStrategy.ColumnName("", fl.StructFieldName())
+	}
+
+	model := fl.Top()
+	if model.Kind() == reflect.Ptr {
+		model = model.Elem()
+	}
+	query := db.WithContext(ctx).Model(reflect.New(model.Type()).Interface()).Where(column+" = ?", fl.Field().Interface())
+
+	// Exclude the record being updated
+	if id := model.FieldByName("ID"); id.IsValid() && !id.IsZero() {
+		query = query.Where("id <> ?", id.Interface())
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return false
+	}
+	return count == 0
+}
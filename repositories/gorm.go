@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"microservice/models"
+
+	"gorm.io/gorm"
+)
+
+// GormUsers stores users in the database
+type GormUsers struct {
+	db *gorm.DB
+}
+
+// NewGormUsers returns a repository of the users of db
+func NewGormUsers(db *gorm.DB) *GormUsers {
+	return &GormUsers{db: db}
+}
+
+// Find loads the user with the ID
+func (r *GormUsers) Find(ctx context.Context, id uint, withTrashed bool) (*models.User, error) {
+	var user models.User
+	if err := models.FindByID(r.db.WithContext(ctx), &user, id, withTrashed); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindByEmail loads the user with the email, ignoring case like the unique index of emails
+func (r *GormUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Where("LOWER(email) = ?", models.NormalizeEmail(email)).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindByInvitation loads the user with the invitation hash
+func (r *GormUsers) FindByInvitation(ctx context.Context, hash string) (*models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Where("invitation_hash = ?", hash).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// EmailTaken counts the other users with the email, ignoring case like the unique index of emails
+func (r *GormUsers) EmailTaken(ctx context.Context, email string, exceptID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.User{}).Where("LOWER(email) = ? AND id <> ?", models.NormalizeEmail(email), exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+// Create inserts the user
+func (r *GormUsers) Create(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+// Update saves the user at its current version
+func (r *GormUsers) Update(ctx context.Context, user *models.User) error {
+	return models.SaveVersioned(r.db.WithContext(ctx), user)
+}
+
+// Delete deletes the user at its current version
+func (r *GormUsers) Delete(ctx context.Context, user *models.User, hard bool) error {
+	query := r.db.WithContext(ctx)
+	if hard {
+		query = query.Unscoped()
+	}
+	result := query.Where("version = ?", user.Version).Delete(user)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrVersionConflict
+	}
+	return nil
+}
+
+// Restore undeletes the user at its current version
+func (r *GormUsers) Restore(ctx context.Context, user *models.User) error {
+	return models.Restore(r.db.WithContext(ctx), user)
+}
+
+// Search queries the search backend registered with the database, then loads the matching users
+func (r *GormUsers) Search(ctx context.Context, query string, limit, offset int) ([]UserHit, int, error) {
+	search := models.SearchOf(r.db)
+	if search == nil {
+		return nil, 0, ErrSearchUnavailable
+	}
+	db := r.db.WithContext(ctx)
+	user := &models.User{}
+	table, err := models.TableName(db, user)
+	if err != nil {
+		return nil, 0, err
+	}
+	hits, total, err := search.Search(db, table, user.SearchFields(), query, limit, offset)
+	if err != nil || len(hits) == 0 {
+		return nil, total, err
+	}
+
+	// Load the matching users, keeping the relevance order of the hits
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	var users []models.User
+	if err := db.Where("id IN (?)", ids).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	byID := make(map[uint]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+	result := make([]UserHit, 0, len(hits))
+	for _, hit := range hits {
+		if user, ok := byID[hit.ID]; ok {
+			result = append(result, UserHit{User: user, Rank: hit.Rank, Highlights: hit.Highlights})
+		}
+	}
+	return result, total, nil
+}
+
+// Query returns the query of the users of the database
+func (r *GormUsers) Query(ctx context.Context) (*gorm.DB, error) {
+	return r.db.WithContext(ctx), nil
+}
+
+// AttributeSchema loads the attribute definitions
+func (r *GormUsers) AttributeSchema(ctx context.Context) (models.AttributeSchema, error) {
+	return models.LoadAttributeSchema(r.db.WithContext(ctx))
+}
+
+// Transaction runs fn in a database transaction, joining the current one if any
+func (r *GormUsers) Transaction(ctx context.Context, fn func(users UserRepository) error) error {
+	return models.Transaction(r.db.WithContext(ctx), func(tx *gorm.DB) error {
+		return fn(NewGormUsers(tx))
+	})
+}
@@ -0,0 +1,224 @@
+package repositories
+
+import (
+	"context"
+	"microservice/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryUsers stores users in memory, for tests and for running handlers without a database
+type MemoryUsers struct {
+	// Schema holds the attribute definitions returned by AttributeSchema
+	Schema models.AttributeSchema
+
+	mu     sync.Mutex
+	users  map[uint]models.User
+	lastID uint
+}
+
+// NewMemoryUsers returns an empty repository
+func NewMemoryUsers() *MemoryUsers {
+	return &MemoryUsers{Schema: models.AttributeSchema{}, users: make(map[uint]models.User)}
+}
+
+// Find returns a copy of the user with the ID
+func (r *MemoryUsers) Find(ctx context.Context, id uint, withTrashed bool) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.users[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	if stored.DeletedAt.Valid && !withTrashed {
+		return nil, models.ErrGone
+	}
+	return loaded(stored), nil
+}
+
+// FindByEmail returns a copy of the user with the email, ignoring case
+func (r *MemoryUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.users {
+		if !stored.DeletedAt.Valid && strings.EqualFold(stored.Email, email) {
+			return loaded(stored), nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+// FindByInvitation returns a copy of the user with the invitation hash
+func (r *MemoryUsers) FindByInvitation(ctx context.Context, hash string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.users {
+		if !stored.DeletedAt.Valid && hash != "" && stored.InvitationHash == hash {
+			return loaded(stored), nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+// EmailTaken looks for other users with the email ignoring case, excluding soft-deleted users
+func (r *MemoryUsers) EmailTaken(ctx context.Context, email string, exceptID uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, stored := range r.users {
+		if id != exceptID && !stored.DeletedAt.Valid && strings.EqualFold(stored.Email, email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Create stores a copy of the user under the next ID
+func (r *MemoryUsers) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user.BeforeCreate(nil)
+	r.lastID++
+	now := time.Now()
+	user.ID, user.CreatedAt, user.UpdatedAt = r.lastID, now, now
+	r.store(user)
+	return nil
+}
+
+// Update replaces the stored copy of the user
+func (r *MemoryUsers) Update(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.users[user.ID]
+	if !ok || stored.DeletedAt.Valid || stored.Version != user.Version {
+		return models.ErrVersionConflict
+	}
+	user.SetVersion(user.Version + 1)
+	user.UpdatedAt = time.Now()
+	r.store(user)
+	return nil
+}
+
+// Delete marks the stored user as deleted, or removes it when hard is set
+func (r *MemoryUsers) Delete(ctx context.Context, user *models.User, hard bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.users[user.ID]
+	if !ok || (stored.DeletedAt.Valid && !hard) || stored.Version != user.Version {
+		return models.ErrVersionConflict
+	}
+	if hard {
+		delete(r.users, user.ID)
+		return nil
+	}
+	deletedAt := gorm.DeletedAt{Time: time.Now(), Valid: true}
+	stored.DeletedAt = deletedAt
+	r.users[user.ID] = stored
+	user.DeletedAt = deletedAt
+	return nil
+}
+
+// Restore clears the deletion time of the stored user
+func (r *MemoryUsers) Restore(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return models.ErrVersionConflict
+	}
+	stored.DeletedAt = gorm.DeletedAt{}
+	stored.Version++
+	r.users[user.ID] = stored
+	user.DeletedAt = gorm.DeletedAt{}
+	user.SetVersion(stored.Version)
+	return nil
+}
+
+// Search returns the users whose name or email contains every word of the query, ordered by
+// ID as every match is equally relevant, without highlights
+func (r *MemoryUsers) Search(ctx context.Context, query string, limit, offset int) ([]UserHit, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	words := strings.Fields(strings.ToLower(query))
+	var hits []UserHit
+	for _, stored := range r.users {
+		text := strings.ToLower(stored.Name + " " + stored.Email)
+		matches := !stored.DeletedAt.Valid && len(words) > 0
+		for _, word := range words {
+			matches = matches && strings.Contains(text, word)
+		}
+		if matches {
+			hits = append(hits, UserHit{User: loaded(stored), Rank: 1, Highlights: map[string]string{}})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].User.ID < hits[j].User.ID })
+
+	total := len(hits)
+	if offset >= total {
+		return nil, total, nil
+	}
+	hits = hits[offset:]
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, total, nil
+}
+
+// Query returns ErrQueryUnsupported, as the list filters are SQL
+func (r *MemoryUsers) Query(ctx context.Context) (*gorm.DB, error) {
+	return nil, ErrQueryUnsupported
+}
+
+// AttributeSchema returns the Schema field
+func (r *MemoryUsers) AttributeSchema(ctx context.Context) (models.AttributeSchema, error) {
+	return r.Schema, nil
+}
+
+// Transaction restores the users stored before fn when it fails. Unlike database
+// transactions, writes of concurrent callers are not isolated from fn and are undone too.
+func (r *MemoryUsers) Transaction(ctx context.Context, fn func(users UserRepository) error) error {
+	r.mu.Lock()
+	snapshot := make(map[uint]models.User, len(r.users))
+	for id, stored := range r.users {
+		snapshot[id] = stored
+	}
+	lastID := r.lastID
+	r.mu.Unlock()
+
+	if err := fn(r); err != nil {
+		r.mu.Lock()
+		r.users, r.lastID = snapshot, lastID
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// store keeps a copy of the user, which the caller can modify without affecting the repository,
+// and sets its ETag and avatar URL like the database hooks
+func (r *MemoryUsers) store(user *models.User) {
+	r.users[user.ID] = *copyUser(user)
+	user.AfterFind(nil)
+}
+
+// loaded returns a copy of a stored user, as loaded from the database
+func loaded(stored models.User) *models.User {
+	user := copyUser(&stored)
+	user.AfterFind(nil)
+	return user
+}
+
+// copyUser copies the user with its metadata
+func copyUser(user *models.User) *models.User {
+	clone := *user
+	if user.Metadata != nil {
+		clone.Metadata = make(models.Metadata, len(user.Metadata))
+		for name, value := range user.Metadata {
+			clone.Metadata[name] = value
+		}
+	}
+	return &clone
+}
@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"microservice/models"
+
+	"gorm.io/gorm"
+)
+
+// Errors returned by repositories lacking a capability of the database
+var (
+	ErrSearchUnavailable = errors.New("full-text search is unavailable")
+	ErrQueryUnsupported  = errors.New("repository cannot run database queries")
+)
+
+// UserHit is a user matching a full-text search, with its relevance and highlighted fragments
+type UserHit struct {
+	User       *models.User
+	Rank       float64
+	Highlights map[string]string
+}
+
+// UserRepository stores users. Lookups return models.ErrNotFound for unknown users and
+// models.ErrGone for soft-deleted users, and writes return models.ErrVersionConflict when
+// the user was modified since it was read. Methods stop when ctx is canceled.
+type UserRepository interface {
+	// Find returns the user with the ID, including soft-deleted users when withTrashed is set
+	Find(ctx context.Context, id uint, withTrashed bool) (*models.User, error)
+	// FindByEmail returns the user with the email, excluding soft-deleted users
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// FindByInvitation returns the user with the hash of a pending invitation token
+	FindByInvitation(ctx context.Context, hash string) (*models.User, error)
+	// EmailTaken reports whether a user other than the one with exceptID has the email
+	EmailTaken(ctx context.Context, email string, exceptID uint) (bool, error)
+	// Create stores a new user, setting its ID, version and timestamps
+	Create(ctx context.Context, user *models.User) error
+	// Update saves the user if it was not modified since it was read, incrementing its version
+	Update(ctx context.Context, user *models.User) error
+	// Delete soft-deletes the user, or permanently deletes it when hard is set, if it was
+	// not modified since it was read
+	Delete(ctx context.Context, user *models.User, hard bool) error
+	// Restore undeletes a soft-deleted user if it was not modified since it was read
+	Restore(ctx context.Context, user *models.User) error
+	// Search returns a page of the users matching the full-text query ordered by relevance and
+	// the total number of matches, or ErrSearchUnavailable without a search backend
+	Search(ctx context.Context, query string, limit, offset int) ([]UserHit, int, error)
+	// Query returns the query of the users table, for the filters, ordering and pagination of
+	// the list endpoints, which are SQL. Repositories without a database return ErrQueryUnsupported.
+	Query(ctx context.Context) (*gorm.DB, error)
+	// AttributeSchema returns the definitions of the custom attributes of users
+	AttributeSchema(ctx context.Context) (models.AttributeSchema, error)
+	// Transaction runs fn with a repository whose writes are rolled back when fn fails
+	Transaction(ctx context.Context, fn func(users UserRepository) error) error
+}
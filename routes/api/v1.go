@@ -2,10 +2,25 @@ package api
 
 import (
     "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+    "microservice/config"
+    controllers "microservice/controllers/api/v1"
+    "microservice/jobs"
+    "microservice/models"
+    "microservice/repositories"
     "microservice/routes/api/v1"
+    "microservice/services"
 )
 
-func SetupV1Routes(router *gin.Engine) {
-    v1.SetupUserRoutes(router)
-    v1.SetupAuthRoutes(router)
+// SetupV1Routes sets up the V1 API routes, wiring their handlers to db. Users are managed
+// through the user service, their avatars stored in the blob store registered with db, and
+// imported in the background. Health checks are served by health.
+func SetupV1Routes(router *gin.Engine, cfg *config.Config, db *gorm.DB, background *jobs.Background, health *controllers.HealthHandler) {
+    service := services.NewUserService(repositories.NewGormUsers(db), models.BlobsOf(db), cfg.Users.InvitationTTL)
+    users := controllers.NewUserHandler(service, background)
+    v1.SetupUserRoutes(router, cfg, db, users)
+    v1.SetupAuthRoutes(router, controllers.NewAuthHandler(db))
+    v1.SetupAttributeRoutes(router, cfg, db, controllers.NewAttributeHandler(db))
+    v1.SetupGroupRoutes(router, cfg, db, controllers.NewGroupHandler(db))
+    v1.SetupHealthRoutes(router, health)
 }
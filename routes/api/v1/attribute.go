@@ -0,0 +1,26 @@
+package v1
+
+import (
+	"microservice/config"
+	v1 "microservice/controllers/api/v1"
+	"microservice/middlewares"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func SetupAttributeRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, handler *v1.AttributeHandler) {
+	attributes := router.Group("/api/v1/attributes")
+
+	// Public routes
+	attributes.GET("", handler.ListAttributes)
+	attributes.GET("/:id", handler.GetAttribute)
+
+	// Private routes, managing the attribute schema of users
+	attributes.Use(middlewares.JWTMiddleware(cfg.Auth, db), middlewares.CheckScope("manage:attributes"))
+	{
+		attributes.POST("", middlewares.Idempotency(db, cfg.API.IdempotencyTTL), handler.CreateAttribute)
+		attributes.PUT("/:id", handler.UpdateAttribute)
+		attributes.DELETE("/:id", handler.DeleteAttribute)
+	}
+}
@@ -6,9 +6,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupAuthRoutes(router *gin.Engine) {
+func SetupAuthRoutes(router *gin.Engine, handler *v1.AuthHandler) {
 	auth := router.Group("/api/v1/oauth")
 
 	// Public routes
-	auth.POST("/token", v1.GenerateJWT)
+	auth.POST("/token", handler.GenerateJWT)
 }
@@ -0,0 +1,29 @@
+package v1
+
+import (
+	"microservice/config"
+	v1 "microservice/controllers/api/v1"
+	"microservice/middlewares"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func SetupGroupRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, handler *v1.GroupHandler) {
+	groups := router.Group("/api/v1/groups")
+
+	// Public routes
+	groups.GET("", handler.ListGroups)
+	groups.GET("/:id", handler.GetGroup)
+	groups.GET("/:id/members", handler.ListGroupMembers)
+
+	// Private routes, managing groups and their members
+	groups.Use(middlewares.JWTMiddleware(cfg.Auth, db), middlewares.CheckScope("manage:groups"))
+	{
+		groups.POST("", middlewares.Idempotency(db, cfg.API.IdempotencyTTL), handler.CreateGroup)
+		groups.PUT("/:id", handler.UpdateGroup)
+		groups.DELETE("/:id", handler.DeleteGroup)
+		groups.POST("/:id/members", handler.AddGroupMember)
+		groups.DELETE("/:id/members/:type/:member_id", handler.RemoveGroupMember)
+	}
+}
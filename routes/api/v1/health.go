@@ -0,0 +1,12 @@
+package v1
+
+import (
+	v1 "microservice/controllers/api/v1"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupHealthRoutes(router *gin.Engine, handler *v1.HealthHandler) {
+	// Public routes
+	router.GET("/api/v1/health", handler.HealthCheck)
+}
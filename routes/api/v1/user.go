@@ -1,28 +1,64 @@
 package v1
 
 import (
+	"microservice/config"
 	v1 "microservice/controllers/api/v1"
 	"microservice/middlewares"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func SetupUserRoutes(router *gin.Engine) {
+func SetupUserRoutes(router *gin.Engine, cfg *config.Config, db *gorm.DB, handler *v1.UserHandler) {
 	users := router.Group("/api/v1/users")
 
-	// Public routes
+	// Public routes, authenticated when a token is sent to read attributes requiring a scope
+	optionalAuth := middlewares.OptionalJWTMiddleware(cfg.Auth, db)
 	users.OPTIONS("", v1.OptionsUsers)
 	users.HEAD("", v1.HeadUsers)
-	users.GET("", v1.ListUsers)
-	users.GET("/:id", v1.GetUser)
+	users.GET("", optionalAuth, handler.ListUsers)
+	users.GET("/search", optionalAuth, handler.SearchUsers)
+	users.GET("/:id", optionalAuth, handler.GetUser)
+	users.GET("/:id/avatar", handler.GetUserAvatar)
 	users.GET("/dummy", v1.DummyListUsers)
+	users.POST("/invitations/accept", handler.AcceptInvitation)
 
-	// Private routes
-	users.Use(middlewares.JWTMiddleware())
+	// Private routes, POST requests being safe to retry with an Idempotency-Key header
+	idempotency := middlewares.Idempotency(db, cfg.API.IdempotencyTTL)
+	users.Use(middlewares.JWTMiddleware(cfg.Auth, db))
 	{
-		users.POST("", middlewares.CheckScope("create:users"), v1.CreateUser)
-		users.PUT("/:id", middlewares.CheckScope("update:users"), v1.UpdateUser)
-		users.PATCH("/:id", middlewares.CheckScope("update:users"), v1.UpdateUser)
-		users.DELETE("/:id", middlewares.CheckScope("delete:users"), v1.DeleteUser)
+		users.POST("", middlewares.CheckScope("create:users"), idempotency, handler.CreateUser)
+		users.PUT("/:id", middlewares.CheckScope("update:users"), handler.UpdateUser)
+		users.PATCH("/:id", middlewares.CheckScope("update:users"), handler.PatchUser)
+		users.PUT("/:id/avatar", middlewares.CheckScope("update:users"), handler.PutUserAvatar)
+		users.DELETE("/:id/avatar", middlewares.CheckScope("update:users"), handler.DeleteUserAvatar)
+		users.DELETE("/:id", middlewares.CheckScope("delete:users"), handler.DeleteUser)
+		users.POST("/:id/restore", middlewares.CheckScope("delete:users"), idempotency, handler.RestoreUser)
+		users.POST("/:id/status", middlewares.CheckScope("admin:users"), handler.ChangeUserStatus)
+		users.POST("/invitations", middlewares.CheckScope("admin:users"), idempotency, handler.InviteUser)
+		users.POST("/:id/invitation", middlewares.CheckScope("admin:users"), handler.ReissueInvitation)
+		users.GET("/export", middlewares.CheckScope("read:users"), handler.ExportUsers)
+		users.POST("/import", middlewares.CheckScope("create:users"), middlewares.CheckScope("update:users"), idempotency, handler.ImportUsers)
+		users.GET("/import/:id", middlewares.CheckScope("create:users"), handler.GetImportJob)
+	}
+
+	// Custom methods such as POST /api/v1/users:batch, checking scopes per operation
+	router.POST("/api/v1/users:method", middlewares.JWTMiddleware(cfg.Auth, db), idempotency, customMethods(map[string]gin.HandlerFunc{
+		"batch": handler.BatchUsers,
+	}))
+}
+
+// customMethods dispatches requests to "<collection>:<method>" paths. Gin cannot escape
+// the colon, so the method is captured by the :method parameter, colon included.
+func customMethods(handlers map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler, ok := handlers[strings.TrimPrefix(c.Param("method"), ":")]
+		if !ok {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		handler(c)
 	}
 }
@@ -1,21 +1,31 @@
 package routes
 
 import (
+	"microservice/config"
+	v1 "microservice/controllers/api/v1"
+	"microservice/jobs"
+	"microservice/middlewares"
 	"microservice/routes/api"
 	"microservice/routes/web"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// SetupRouter sets up the routes for the Gin engine
-func SetupRouter() *gin.Engine {
+// SetupRouter sets up the routes for the Gin engine, making the configuration available to handlers
+// and wiring the handlers to the database. Work outliving requests runs in background, and health
+// checks are served by health, which the caller drains at shutdown. Validation errors are
+// translated once the validations are registered, as the connect step of the CLI does.
+func SetupRouter(cfg *config.Config, db *gorm.DB, background *jobs.Background, health *v1.HealthHandler) *gin.Engine {
 	router := gin.Default()
 
+	router.Use(config.Inject(cfg), middlewares.Locale())
+
 	// Setup base routes
 	web.SetupBaseRoutes(router)
 
 	// Setup V1 API routes
-	api.SetupV1Routes(router)
+	api.SetupV1Routes(router, cfg, db, background, health)
 
 	return router
 }
@@ -0,0 +1,94 @@
+package search
+
+import (
+	"fmt"
+	"microservice/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Postgres is a search backend storing a weighted tsvector column on each indexed table
+type Postgres struct{}
+
+// Setup indexes the records that are not indexed yet, in the tsvector column created by the migrations
+func (p *Postgres) Setup(db *gorm.DB, table string, fields []string) error {
+	return db.Exec(fmt.Sprintf("UPDATE %s SET search_vector = %s WHERE search_vector IS NULL AND deleted_at IS NULL", table, vectorExpression(fields))).Error
+}
+
+// Index recomputes the tsvector of a record
+func (p *Postgres) Index(db *gorm.DB, table string, id interface{}, fields []string, document map[string]string) error {
+	var placeholders []string
+	var values []interface{}
+	for _, field := range fields {
+		placeholders = append(placeholders, "?")
+		values = append(values, document[field])
+	}
+	values = append(values, id)
+	return db.Exec(fmt.Sprintf("UPDATE %s SET search_vector = %s WHERE id = ?", table, vectorExpression(placeholders)), values...).Error
+}
+
+// Remove clears the tsvector of a record
+func (p *Postgres) Remove(db *gorm.DB, table string, id interface{}) error {
+	return db.Exec(fmt.Sprintf("UPDATE %s SET search_vector = NULL WHERE id = ?", table), id).Error
+}
+
+// Search matches every term as a prefix, ranking hits with ts_rank
+func (p *Postgres) Search(db *gorm.DB, table string, fields []string, query string, limit, offset int) ([]models.SearchHit, int, error) {
+	var prefixes []string
+	for _, term := range terms(query) {
+		prefixes = append(prefixes, "'"+term+"':*")
+	}
+	if len(prefixes) == 0 {
+		return nil, 0, nil
+	}
+	tsquery := strings.Join(prefixes, " & ")
+
+	var total int
+	if err := db.Raw(fmt.Sprintf("SELECT count(*) FROM %s WHERE search_vector @@ to_tsquery('simple', ?) AND deleted_at IS NULL", table), tsquery).Row().Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	selects := []string{"id", "ts_rank(search_vector, query)"}
+	for _, field := range fields {
+		selects = append(selects, fmt.Sprintf("ts_headline('simple', coalesce(%s, ''), query, 'StartSel=%s, StopSel=%s, HighlightAll=true')", field, matchStart, matchEnd))
+	}
+	rows, err := db.Raw(fmt.Sprintf(
+		"SELECT %s FROM %s, to_tsquery('simple', ?) query WHERE search_vector @@ query AND deleted_at IS NULL ORDER BY 2 DESC, id LIMIT ? OFFSET ?",
+		strings.Join(selects, ", "), table,
+	), tsquery, limit, offset).Rows()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var hits []models.SearchHit
+	for rows.Next() {
+		var hit models.SearchHit
+		highlights := make([]string, len(fields))
+		dest := []interface{}{&hit.ID, &hit.Rank}
+		for i := range highlights {
+			dest = append(dest, &highlights[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+		hit.Highlights = make(map[string]string, len(fields))
+		for i, field := range fields {
+			hit.Highlights[field] = highlight(highlights[i])
+		}
+		hits = append(hits, hit)
+	}
+	return hits, total, rows.Err()
+}
+
+// vectorExpression builds the weighted tsvector of the given values, the first one weighing most
+func vectorExpression(values []string) string {
+	weights := []string{"A", "B", "C", "D"}
+	var parts []string
+	for i, value := range values {
+		weight := weights[min(i, len(weights)-1)]
+		parts = append(parts, fmt.Sprintf("setweight(to_tsvector('simple', coalesce(%s, '')), '%s')", value, weight))
+	}
+	return strings.Join(parts, " || ")
+}
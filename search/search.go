@@ -0,0 +1,68 @@
+package search
+
+import (
+	"fmt"
+	"html"
+	"microservice/models"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Markers wrapped around matched fragments in highlights, whose text is HTML-escaped
+const (
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+)
+
+// Markers the backends wrap matched fragments in, private-use characters which the text is
+// escaped around before they are replaced by the HTML markers
+const (
+	matchStart = "\uE000"
+	matchEnd   = "\uE001"
+)
+
+// highlight escapes the text of a field marked by a backend, then replaces the match markers
+// with the highlight markers, so that names and emails cannot inject HTML
+func highlight(marked string) string {
+	return strings.NewReplacer(matchStart, HighlightStart, matchEnd, HighlightEnd).Replace(html.EscapeString(marked))
+}
+
+// New returns the search backend for the dialect of the database
+func New(db *gorm.DB) (models.SearchIndex, error) {
+	switch dialect := db.Dialector.Name(); dialect {
+	case "sqlite":
+		var fts5 bool
+		if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5).Error; err != nil {
+			return nil, err
+		}
+		if !fts5 {
+			return nil, fmt.Errorf("SQLite is built without FTS5, build with the sqlite_fts5 tag")
+		}
+		return &SQLite{}, nil
+	case "postgres":
+		return &Postgres{}, nil
+	default:
+		return nil, fmt.Errorf("full-text search is not supported on %s", dialect)
+	}
+}
+
+// terms splits a user query into prefix search terms, dropping characters that have
+// a meaning in the query syntax of the backends
+func terms(query string) []string {
+	var result []string
+	for _, word := range strings.Fields(query) {
+		term := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '@' || r == '.' || r == '_' || r == '-' {
+				return r
+			}
+			return -1
+		}, word)
+		term = strings.Trim(term, ".-")
+		if term != "" {
+			result = append(result, strings.ToLower(term))
+		}
+	}
+	return result
+}
@@ -0,0 +1,11 @@
+package search
+
+import "testing"
+
+func TestHighlightEscapesText(t *testing.T) {
+	marked := matchStart + "Ann" + matchEnd + ` <img src=x onerror="alert(1)">`
+	want := `<mark>Ann</mark> &lt;img src=x onerror=&#34;alert(1)&#34;&gt;`
+	if got := highlight(marked); got != want {
+		t.Errorf("highlight(%q) = %q, want %q", marked, got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"fmt"
+	"microservice/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SQLite is a search backend using an FTS5 virtual table per indexed table.
+// The driver must be built with the sqlite_fts5 tag.
+type SQLite struct{}
+
+// Setup indexes the records that are not indexed yet, in the FTS5 table created by the migrations
+func (s *SQLite) Setup(db *gorm.DB, table string, fields []string) error {
+	columns := strings.Join(fields, ", ")
+	return db.Exec(fmt.Sprintf(
+		"INSERT INTO %[1]s (rowid, %[2]s) SELECT id, %[2]s FROM %[3]s WHERE deleted_at IS NULL AND id NOT IN (SELECT rowid FROM %[1]s)",
+		ftsTable(table), columns, table,
+	)).Error
+}
+
+// Index replaces the FTS5 row of a record
+func (s *SQLite) Index(db *gorm.DB, table string, id interface{}, fields []string, document map[string]string) error {
+	if err := s.Remove(db, table, id); err != nil {
+		return err
+	}
+
+	columns := []string{"rowid"}
+	placeholders := []string{"?"}
+	values := []interface{}{id}
+	for _, field := range fields {
+		columns = append(columns, field)
+		placeholders = append(placeholders, "?")
+		values = append(values, document[field])
+	}
+	return db.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", ftsTable(table), strings.Join(columns, ", "), strings.Join(placeholders, ", ")), values...).Error
+}
+
+// Remove deletes the FTS5 row of a record
+func (s *SQLite) Remove(db *gorm.DB, table string, id interface{}) error {
+	return db.Exec(fmt.Sprintf("DELETE FROM %s WHERE rowid = ?", ftsTable(table)), id).Error
+}
+
+// Search matches every term as a prefix, ranking hits with BM25
+func (s *SQLite) Search(db *gorm.DB, table string, fields []string, query string, limit, offset int) ([]models.SearchHit, int, error) {
+	var quoted []string
+	for _, term := range terms(query) {
+		quoted = append(quoted, `"`+term+`"*`)
+	}
+	if len(quoted) == 0 {
+		return nil, 0, nil
+	}
+	match := strings.Join(quoted, " ")
+	fts := ftsTable(table)
+
+	// Entries of soft-deleted records are skipped, including those deleted without hooks
+	where := fmt.Sprintf("%[1]s MATCH ? AND rowid IN (SELECT id FROM %[2]s WHERE deleted_at IS NULL)", fts, table)
+
+	var total int
+	if err := db.Raw(fmt.Sprintf("SELECT count(*) FROM %s WHERE %s", fts, where), match).Row().Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	selects := []string{"rowid", fmt.Sprintf("bm25(%s)", fts)}
+	for i := range fields {
+		selects = append(selects, fmt.Sprintf("highlight(%s, %d, '%s', '%s')", fts, i, matchStart, matchEnd))
+	}
+	rows, err := db.Raw(fmt.Sprintf("SELECT %[2]s FROM %[1]s WHERE %[3]s ORDER BY bm25(%[1]s) LIMIT ? OFFSET ?", fts, strings.Join(selects, ", "), where), match, limit, offset).Rows()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var hits []models.SearchHit
+	for rows.Next() {
+		var hit models.SearchHit
+		highlights := make([]string, len(fields))
+		dest := []interface{}{&hit.ID, &hit.Rank}
+		for i := range highlights {
+			dest = append(dest, &highlights[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+
+		// BM25 scores are lower for better matches
+		hit.Rank = -hit.Rank
+		hit.Highlights = make(map[string]string, len(fields))
+		for i, field := range fields {
+			hit.Highlights[field] = highlight(highlights[i])
+		}
+		hits = append(hits, hit)
+	}
+	return hits, total, rows.Err()
+}
+
+// ftsTable returns the name of the FTS5 table indexing table
+func ftsTable(table string) string {
+	return table + "_fts"
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"microservice/imaging"
+	"microservice/models"
+	"microservice/repositories"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Errors returned by the user service, besides the errors of the repository
+var (
+	ErrNotDeleted         = errors.New("user is not deleted")
+	ErrEmailTaken         = errors.New("email is taken by another user")
+	ErrNotInvited         = errors.New("user is not invited")
+	ErrAvatarsUnavailable = errors.New("avatar storage is unavailable")
+	ErrNoAvatar           = errors.New("user has no avatar")
+)
+
+// TransitionError reports a status change the state machine of users does not allow
+type TransitionError struct {
+	From    string   // Current status of the user
+	Allowed []string // Statuses the user can change to
+}
+
+// Error describes the transition
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("status %s can only change to %s", e.From, strings.Join(e.Allowed, ", "))
+}
+
+// Unwrap returns models.ErrInvalidTransition
+func (e *TransitionError) Unwrap() error {
+	return models.ErrInvalidTransition
+}
+
+// ValidationError reports a user whose fields break the validation rules
+type ValidationError struct {
+	Err error // Validation errors of the fields
+}
+
+// Error returns the validation errors
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the validation errors
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// UserService applies the rules of creating, changing and deleting users. Methods stop
+// when ctx is canceled.
+type UserService struct {
+	users repositories.UserRepository
+	// blobs stores the avatar thumbnails, nil when avatars are unavailable
+	blobs models.BlobStore
+	// invitationTTL is how long invitation tokens remain valid
+	invitationTTL time.Duration
+}
+
+// NewUserService returns a service storing users in the repository and their avatars in
+// blobs, which may be nil, issuing invitations valid for invitationTTL
+func NewUserService(users repositories.UserRepository, blobs models.BlobStore, invitationTTL time.Duration) *UserService {
+	return &UserService{users: users, blobs: blobs, invitationTTL: invitationTTL}
+}
+
+// Get returns the user with the ID, including soft-deleted users when withTrashed is set
+func (s *UserService) Get(ctx context.Context, id uint, withTrashed bool) (*models.User, error) {
+	return s.users.Find(ctx, id, withTrashed)
+}
+
+// Search returns a page of the users matching the full-text query ordered by relevance and
+// the total number of matches, or repositories.ErrSearchUnavailable
+func (s *UserService) Search(ctx context.Context, query string, limit, offset int) ([]repositories.UserHit, int, error) {
+	return s.users.Search(ctx, query, limit, offset)
+}
+
+// Query returns the query of the users table the list endpoints filter and paginate,
+// or repositories.ErrQueryUnsupported
+func (s *UserService) Query(ctx context.Context) (*gorm.DB, error) {
+	return s.users.Query(ctx)
+}
+
+// AttributeSchema returns the definitions of the custom attributes of users
+func (s *UserService) AttributeSchema(ctx context.Context) (models.AttributeSchema, error) {
+	return s.users.AttributeSchema(ctx)
+}
+
+// Create validates and stores a new user, ignoring the read-only fields set by the client
+func (s *UserService) Create(ctx context.Context, user *models.User) error {
+	user.Base = models.Base{}
+	user.Lifecycle = models.Lifecycle{}
+	if err := s.validate(ctx, user); err != nil {
+		return err
+	}
+	return s.users.Create(ctx, user)
+}
+
+// Invite validates and stores a new user in the invited status, returning the invitation
+// token the user sets their password with
+func (s *UserService) Invite(ctx context.Context, user *models.User) (string, error) {
+	user.Base = models.Base{}
+	user.Lifecycle = models.Lifecycle{}
+	if err := s.validate(ctx, user); err != nil {
+		return "", err
+	}
+	token, err := user.Invite(s.invitationTTL)
+	if err != nil {
+		return "", err
+	}
+	return token, s.users.Create(ctx, user)
+}
+
+// Reinvite issues a new invitation token for an invited user, invalidating the previous one
+func (s *UserService) Reinvite(ctx context.Context, user *models.User) (string, error) {
+	if user.Status != models.StatusInvited {
+		return "", ErrNotInvited
+	}
+	token, err := user.Invite(s.invitationTTL)
+	if err != nil {
+		return "", err
+	}
+	return token, s.users.Update(ctx, user)
+}
+
+// AcceptInvitation sets the password of the user invited with the token and activates the
+// account. It returns models.ErrInvalidInvitation for unknown, expired and already accepted tokens.
+func (s *UserService) AcceptInvitation(ctx context.Context, token, password string) (*models.User, error) {
+	user, err := s.users.FindByInvitation(ctx, models.HashInvitation(token))
+	if err == models.ErrNotFound {
+		return nil, models.ErrInvalidInvitation
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := user.AcceptInvitation(password); err != nil {
+		return nil, err
+	}
+	// A concurrent acceptance consumed the token first
+	if err := s.users.Update(ctx, user); err == models.ErrVersionConflict {
+		return nil, models.ErrInvalidInvitation
+	} else if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ChangeStatus moves the user to another status, recording the reason and optional end date
+// of suspensions. It returns a *TransitionError when the state machine does not allow the change.
+func (s *UserService) ChangeStatus(ctx context.Context, user *models.User, status, reason string, until *time.Time) error {
+	if !user.CanTransition(status) {
+		return &TransitionError{From: user.Status, Allowed: models.StatusTransitions[user.Status]}
+	}
+	if err := user.Transition(status, reason, until); err != nil {
+		return err
+	}
+	return s.users.Update(ctx, user)
+}
+
+// CreateWithPassword validates and stores a new active user with the password
+func (s *UserService) CreateWithPassword(ctx context.Context, user *models.User, password string) error {
+	user.Base = models.Base{}
+	user.Lifecycle = models.Lifecycle{}
+	if err := s.validate(ctx, user); err != nil {
+		return err
+	}
+	if err := user.SetPassword(password); err != nil {
+		return err
+	}
+	return s.users.Create(ctx, user)
+}
+
+// Replace replaces the stored user with user, keeping the read-only fields of the stored user
+func (s *UserService) Replace(ctx context.Context, stored, user *models.User) error {
+	keepReadOnly(stored, user)
+	if err := s.validate(ctx, user); err != nil {
+		return err
+	}
+	return s.users.Update(ctx, user)
+}
+
+// Update validates and saves a user changed in place, such as by a patch
+func (s *UserService) Update(ctx context.Context, user *models.User) error {
+	if err := s.validate(ctx, user); err != nil {
+		return err
+	}
+	return s.users.Update(ctx, user)
+}
+
+// Import creates the user, or replaces the user with the same email if any. keep returns the
+// metadata to save given the metadata of the stored user, which is nil for new users.
+// With dryRun the user is only validated. It reports whether the user is new.
+func (s *UserService) Import(ctx context.Context, user *models.User, keep func(stored models.Metadata) models.Metadata, dryRun bool) (bool, error) {
+	user.Base = models.Base{}
+	user.Lifecycle = models.Lifecycle{}
+	var stored *models.User
+	if user.Email != "" {
+		var err error
+		if stored, err = s.users.FindByEmail(ctx, user.Email); err != nil && err != models.ErrNotFound {
+			return false, err
+		}
+	}
+	if stored != nil {
+		keepReadOnly(stored, user)
+		user.Metadata = keep(stored.Metadata)
+	} else {
+		user.Metadata = keep(nil)
+	}
+	if err := s.validate(ctx, user); err != nil || dryRun {
+		return stored == nil, err
+	}
+
+	if stored != nil {
+		return false, s.users.Update(ctx, user)
+	}
+	return true, s.users.Create(ctx, user)
+}
+
+// Delete soft-deletes the user, or permanently deletes it when hard is set
+func (s *UserService) Delete(ctx context.Context, user *models.User, hard bool) error {
+	return s.users.Delete(ctx, user, hard)
+}
+
+// Restore undeletes a soft-deleted user, unless another user took its email in the meantime
+func (s *UserService) Restore(ctx context.Context, user *models.User) error {
+	if !user.DeletedAt.Valid {
+		return ErrNotDeleted
+	}
+	taken, err := s.users.EmailTaken(ctx, user.Email, user.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+	return s.users.Restore(ctx, user)
+}
+
+// AvatarsAvailable reports whether avatars can be stored
+func (s *UserService) AvatarsAvailable() bool {
+	return s.blobs != nil
+}
+
+// SetAvatar stores the thumbnails of the image under a new key, so that cached avatars are
+// never served stale, then saves the user and deletes the thumbnails of the replaced avatar
+func (s *UserService) SetAvatar(ctx context.Context, user *models.User, img image.Image) error {
+	if s.blobs == nil {
+		return ErrAvatarsUnavailable
+	}
+	token := make([]byte, 8)
+	rand.Read(token)
+	contentType := imaging.Format(img)
+	previous := *user
+	user.Avatar = fmt.Sprintf("avatars/%d/%s%s", user.ID, hex.EncodeToString(token), avatarExtensions[contentType])
+	for size, thumbnail := range imaging.Thumbnails(img, imaging.ThumbnailSizes) {
+		data, err := imaging.Encode(thumbnail, contentType)
+		if err == nil {
+			err = s.blobs.Put(ctx, user.AvatarKey(size), contentType, data)
+		}
+		if err != nil {
+			log.Println("Failed to store avatar:", err)
+			user.DeleteAvatar(ctx, s.blobs)
+			user.Avatar = previous.Avatar
+			return err
+		}
+	}
+
+	if err := s.users.Update(ctx, user); err != nil {
+		user.DeleteAvatar(ctx, s.blobs)
+		user.Avatar = previous.Avatar
+		return err
+	}
+	previous.DeleteAvatar(ctx, s.blobs)
+	return nil
+}
+
+// Avatar opens the thumbnail of the avatar of the user in the size, returning its content type.
+// It returns ErrNoAvatar when the user has no avatar or the thumbnail is missing.
+func (s *UserService) Avatar(ctx context.Context, user *models.User, size string) (io.ReadCloser, string, error) {
+	if s.blobs == nil {
+		return nil, "", ErrAvatarsUnavailable
+	}
+	if user.Avatar == "" {
+		return nil, "", ErrNoAvatar
+	}
+	reader, contentType, err := s.blobs.Get(ctx, user.AvatarKey(size))
+	if err == models.ErrBlobNotFound {
+		return nil, "", ErrNoAvatar
+	}
+	return reader, contentType, err
+}
+
+// RemoveAvatar removes the avatar from the user, then deletes its thumbnails
+func (s *UserService) RemoveAvatar(ctx context.Context, user *models.User) error {
+	if user.Avatar == "" {
+		return ErrNoAvatar
+	}
+	previous := *user
+	user.Avatar = ""
+	if err := s.users.Update(ctx, user); err != nil {
+		user.Avatar = previous.Avatar
+		return err
+	}
+	previous.DeleteAvatar(ctx, s.blobs)
+	return nil
+}
+
+// Transaction runs fn with a service whose changes are rolled back when fn fails
+func (s *UserService) Transaction(ctx context.Context, fn func(users *UserService) error) error {
+	return s.users.Transaction(ctx, func(users repositories.UserRepository) error {
+		return fn(NewUserService(users, s.blobs, s.invitationTTL))
+	})
+}
+
+// avatarExtensions maps thumbnail content types to the extension of their blob keys
+var avatarExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// keepReadOnly copies the fields clients cannot change from the stored user
+func keepReadOnly(stored, user *models.User) {
+	user.Base = stored.Base
+	user.Lifecycle = stored.Lifecycle
+	user.Avatar = stored.Avatar
+}
+
+// validate normalizes the email of the user, then checks the fields of the user, its email
+// against the other users and its custom attributes against the attribute schema
+func (s *UserService) validate(ctx context.Context, user *models.User) error {
+	user.Email = models.NormalizeEmail(user.Email)
+	schema, err := s.users.AttributeSchema(ctx)
+	if err != nil {
+		return err
+	}
+	taken, err := s.users.EmailTaken(ctx, user.Email, user.ID)
+	if err != nil {
+		return err
+	}
+	ctx = models.WithUserChecks(ctx, models.UserChecks{Schema: schema, EmailTaken: taken})
+	if err := models.ValidateStruct(ctx, user); err != nil {
+		return &ValidationError{Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"microservice/models"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores blobs as files under a root directory, deriving content types from key extensions
+type Local struct {
+	root string
+}
+
+// NewLocal returns a blob store rooted at dir, creating the directory if needed
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{root: dir}, nil
+}
+
+// Put writes the blob to a temporary file renamed into place, so readers never see partial blobs
+func (l *Local) Put(ctx context.Context, key, contentType string, data []byte) error {
+	file, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(file), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), file)
+}
+
+// Get opens the file of the blob
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	file, err := l.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+	reader, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, "", models.ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return reader, contentType, nil
+}
+
+// Delete removes the file of the blob and the directories it leaves empty
+func (l *Local) Delete(ctx context.Context, key string) error {
+	file, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Remove the directories left empty, which fails harmlessly on the first non-empty one
+	for dir := filepath.Dir(file); dir != filepath.Clean(l.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// path returns the file of a key, rejecting keys escaping the root directory
+func (l *Local) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean != "/"+key || strings.HasSuffix(key, "/") {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(clean)), nil
+}
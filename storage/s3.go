@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"microservice/models"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config configures a bucket of Amazon S3 or of an S3-compatible service such as MinIO
+type S3Config struct {
+	Endpoint        string // Base URL of the service, Amazon S3 of the region by default
+	Region          string // Region of the bucket, us-east-1 by default
+	Bucket          string // Name of the bucket
+	AccessKeyID     string // Access key used to sign requests
+	SecretAccessKey string // Secret of the access key
+	PathStyle       bool   // Address the bucket in the path rather than the host name, as most stand-ins require
+}
+
+// S3 stores blobs as objects of an S3 bucket, signing requests with AWS Signature Version 4
+type S3 struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3 returns a blob store for the configured bucket
+func NewS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("S3 bucket is not configured")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("S3 credentials are not configured")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+	return &S3{config: config, endpoint: endpoint, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// Put uploads the object
+func (s *S3) Put(ctx context.Context, key, contentType string, data []byte) error {
+	response, err := s.do(ctx, http.MethodPut, key, contentType, data)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return s.check(response)
+}
+
+// Get downloads the object, returning its stored content type
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	response, err := s.do(ctx, http.MethodGet, key, "", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.check(response); err != nil {
+		response.Body.Close()
+		return nil, "", err
+	}
+	return response.Body, response.Header.Get("Content-Type"), nil
+}
+
+// Delete deletes the object
+func (s *S3) Delete(ctx context.Context, key string) error {
+	response, err := s.do(ctx, http.MethodDelete, key, "", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err := s.check(response); err != nil && err != models.ErrBlobNotFound {
+		return err
+	}
+	return nil
+}
+
+// check returns an error for unsuccessful responses
+func (s *S3) check(response *http.Response) error {
+	if response.StatusCode < 300 {
+		return nil
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return models.ErrBlobNotFound
+	}
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("S3 responded with %s: %s", response.Status, bytes.TrimSpace(message))
+}
+
+// do sends a signed request for the object stored under key
+func (s *S3) do(ctx context.Context, method, key, contentType string, body []byte) (*http.Response, error) {
+	// Address the object in the bucket host name or path
+	target := *s.endpoint
+	escaped := strings.TrimSuffix(target.EscapedPath(), "/")
+	if s.config.PathStyle {
+		escaped += "/" + uriEncode(s.config.Bucket)
+	} else {
+		target.Host = s.config.Bucket + "." + target.Host
+	}
+	escaped += "/" + uriEncode(key)
+	target.Path, _ = url.PathUnescape(escaped)
+	target.RawPath = escaped
+
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	s.sign(request, escaped, body, time.Now())
+	return s.client.Do(request)
+}
+
+// sign adds the AWS Signature Version 4 headers to the request
+func (s *S3) sign(request *http.Request, escapedPath string, body []byte, now time.Time) {
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	timestamp := now.UTC().Format("20060102T150405Z")
+	date := timestamp[:8]
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	request.Header.Set("X-Amz-Date", timestamp)
+
+	// Build the canonical request from the signed headers
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		request.Method, escapedPath, request.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+
+	// Sign the request with a key derived for the date, region and service
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	key := []byte("AWS4" + s.config.SecretAccessKey)
+	for _, part := range []string{date, s.config.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode percent-encodes a key as required by Signature Version 4, keeping slashes
+func uriEncode(key string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(key) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '.', b == '_', b == '~', b == '/':
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"fmt"
+	"microservice/config"
+	"microservice/models"
+)
+
+// New returns the blob store selected by the configured driver: "local" stores blobs
+// under the configured path, "s3" in an S3-compatible bucket
+func New(cfg config.Storage) (models.BlobStore, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocal(cfg.Path)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:        cfg.S3.Endpoint,
+			Region:          cfg.S3.Region,
+			Bucket:          cfg.S3.Bucket,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+			PathStyle:       cfg.S3.PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
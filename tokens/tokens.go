@@ -0,0 +1,78 @@
+package tokens
+
+import (
+	"errors"
+	"microservice/config"
+	"microservice/models"
+	"time"
+
+	"github.com/form3tech-oss/jwt-go"
+	"gorm.io/gorm"
+)
+
+// DefaultScope is the scope of the tokens issued to users. Privileged scopes, such as purge:users,
+// admin:users, manage:attributes and manage:groups, are only granted to clients created with them.
+const DefaultScope = "create:users read:users update:users delete:users"
+
+// TTL is how long issued tokens remain valid by default, and how long retired signing keys
+// keep verifying the tokens they signed
+const TTL = 24 * time.Hour
+
+// Claims describes a token to issue
+type Claims struct {
+	Subject string
+	Scope   string
+	Groups  []string
+	TTL     time.Duration // TTL when zero
+}
+
+// Issue signs a token with the active signing key, or with the configured secret until
+// signing keys are rotated for the first time
+func Issue(db *gorm.DB, auth config.Auth, claims Claims) (string, error) {
+	ttl := claims.TTL
+	if ttl == 0 {
+		ttl = TTL
+	}
+	groups := claims.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":    claims.Subject,
+		"groups": groups,
+		"iss":    auth.Domain,
+		"aud":    auth.Audience,
+		"exp":    time.Now().Add(ttl).Unix(),
+		"scope":  claims.Scope,
+	})
+
+	key, err := models.ActiveSigningKey(db)
+	if err != nil {
+		return "", err
+	}
+	if key != nil {
+		token.Header["kid"] = key.ID
+		return token.SignedString([]byte(key.Secret))
+	}
+	if auth.Secret == "" {
+		return "", errors.New("auth.secret is required to sign tokens before signing keys are rotated")
+	}
+	return token.SignedString([]byte(auth.Secret))
+}
+
+// VerificationKey returns the secret verifying the signature of the token: the signing key
+// named by its kid header, or the configured secret for tokens without one
+func VerificationKey(db *gorm.DB, auth config.Auth, token *jwt.Token) ([]byte, error) {
+	id, ok := token.Header["kid"].(string)
+	if !ok {
+		return []byte(auth.Secret), nil
+	}
+	if db == nil {
+		return nil, models.ErrUnknownSigningKey
+	}
+	key, err := models.FindSigningKey(db, id, TTL)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(key.Secret), nil
+}